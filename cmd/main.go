@@ -2,12 +2,20 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/osmontero/msync/internal/utils"
+	"github.com/osmontero/msync/pkg/filter"
 	"github.com/osmontero/msync/pkg/sync"
 	"github.com/osmontero/msync/pkg/tar"
 )
@@ -17,6 +25,18 @@ var (
 	buildTime = "unknown"
 )
 
+// Exit codes, following rsync where it has an equivalent
+const (
+	exitOK          = 0  // Everything was synced
+	exitFailure     = 1  // The sync could not run or was aborted
+	exitPartial     = 23 // Some files failed to sync
+	exitVanished    = 24 // Some source files vanished before they were synced
+	exitInterrupted = 20 // The sync was stopped by SIGINT or SIGTERM
+)
+
+// errInterrupted is the cause of a sync stopped by a signal
+var errInterrupted = errors.New("interrupted")
+
 type Config struct {
 	Source      string
 	Destination string
@@ -28,9 +48,49 @@ type Config struct {
 	Delete      bool
 	Threads     int
 	Method      string
+	ChecksumAlgo    string
 	ShowHelp    bool
 	ShowVersion bool
 	SkipBrokenLinks bool
+	Delta           bool
+	DeltaBlockSize  int
+	FilterRules     []string // Ordered include/exclude rules in rsync filter syntax
+	IgnoreFiles     []string // Additional per-directory ignore file names
+	GitIgnore       bool
+	Links           bool
+	CopyLinks       bool
+	SafeLinks       bool
+	RewriteLinks    bool
+	DeleteExcluded  bool
+	Archive         bool
+	Perms           bool
+	DirTimes        bool
+	Owner           bool
+	Group           bool
+	NumericIDs      bool
+	HardLinks       bool
+	Xattrs          bool
+	ACLs            bool
+	Sparse          bool
+	Partial         bool
+	CacheDir        string
+	Rehash          bool
+	Verify          bool
+	Itemize         bool
+	Progress        bool
+	LogLevel        string        // debug, info, warn or error ("" = info with --verbose, warn otherwise)
+	LogFormat       string        // text or json
+	Report          string        // Report format written after the sync ("" = none)
+	ReportFile      string        // File the report is written to ("" = standard output)
+	MetricsFile     string        // Prometheus textfile written after the sync ("" = none)
+	MetricsListen   string        // Address serving /metrics during the sync ("" = none)
+	MaxErrors       int           // Abort after this many errors (0 = no limit)
+	BwLimit         string        // Bytes per second with an optional K, M, G suffix ("" = no limit)
+	BwSchedule      string        // Daily bandwidth schedule, e.g. 08:00=20M,19:00=0
+	FilesPerSecond  float64       // Files written per second (0 = no limit)
+	Watch           bool          // Keep syncing changes of the source after the first sync
+	WatchDebounce   time.Duration // Quiet time after a change before syncing it
+	WatchRescan     time.Duration // Interval of full syncs in watch mode (0 = none)
 	// TAR-specific options
 	TarCompress bool
 	GPGEncrypt  bool
@@ -77,6 +137,56 @@ func main() {
 		}
 	}
 
+	// Archive mode is shorthand for preserving links, permissions, directory
+	// times and ownership
+	if config.Archive {
+		config.Recursive = true
+		config.Links = true
+		config.Perms = true
+		config.DirTimes = true
+		config.Owner = true
+		config.Group = true
+	}
+
+	if !sync.ValidChecksumAlgo(config.ChecksumAlgo) {
+		log.Fatalf("Unsupported checksum algorithm: %s (choose from %s)", config.ChecksumAlgo, strings.Join(sync.ChecksumAlgorithms(), ", "))
+	}
+
+	if config.Report != "" && config.Report != "json" {
+		log.Fatalf("Unsupported report format: %s (choose from json)", config.Report)
+	}
+
+	logger, err := newLogger(config)
+	if err != nil {
+		log.Fatalf("Invalid logging option: %v", err)
+	}
+
+	var bwLimit int64
+	if config.BwLimit != "" {
+		if bwLimit, err = utils.ParseBytes(config.BwLimit); err != nil {
+			log.Fatalf("Invalid --bwlimit: %v", err)
+		}
+	}
+	var bwSchedule []sync.BwLimitPeriod
+	if config.BwSchedule != "" {
+		if bwSchedule, err = sync.ParseBwSchedule(config.BwSchedule); err != nil {
+			log.Fatalf("Invalid --bwlimit-schedule: %v", err)
+		}
+	}
+
+	rules, err := filter.Parse(config.FilterRules)
+	if err != nil {
+		log.Fatalf("Invalid filter rule: %v", err)
+	}
+	// Later ignore files take precedence, so .msyncignore overrides .gitignore
+	if config.GitIgnore {
+		rules.AddIgnoreFile(".gitignore")
+	}
+	rules.AddIgnoreFile(".msyncignore")
+	for _, name := range config.IgnoreFiles {
+		rules.AddIgnoreFile(name)
+	}
+
 	// Create synchronizer
 	syncOptions := sync.Options{
 		Checksum:        config.Checksum,
@@ -87,7 +197,39 @@ func main() {
 		Delete:          config.Delete,
 		Threads:         config.Threads,
 		Method:          config.Method,
+		ChecksumAlgo:    config.ChecksumAlgo,
 		SkipBrokenLinks: config.SkipBrokenLinks,
+		Delta:           config.Delta,
+		DeltaBlockSize:  config.DeltaBlockSize,
+		Filter:          rules,
+		DeleteExcluded:  config.DeleteExcluded,
+		Links:           config.Links,
+		CopyLinks:       config.CopyLinks,
+		SafeLinks:       config.SafeLinks,
+		RewriteLinks:    config.RewriteLinks,
+		Perms:           config.Perms,
+		DirTimes:        config.DirTimes,
+		Owner:           config.Owner,
+		Group:           config.Group,
+		NumericIDs:      config.NumericIDs,
+		HardLinks:       config.HardLinks,
+		Xattrs:          config.Xattrs,
+		ACLs:            config.ACLs,
+		Sparse:          config.Sparse,
+		Partial:         config.Partial,
+		CacheDir:        config.CacheDir,
+		Rehash:          config.Rehash,
+		Verify:          config.Verify,
+		Itemize:         config.Itemize,
+		MaxErrors:       config.MaxErrors,
+		BwLimit:         bwLimit,
+		BwSchedule:      bwSchedule,
+		FilesPerSecond:  config.FilesPerSecond,
+		WatchDebounce:   config.WatchDebounce,
+		WatchRescan:     config.WatchRescan,
+		Logger:          logger,
+		Output:          os.Stdout,
+		Report:          config.Report != "",
 		TarCompress:     config.TarCompress,
 		GPGEncrypt:      config.GPGEncrypt,
 		GPGSign:         config.GPGSign,
@@ -122,9 +264,63 @@ func main() {
 		syncer = sync.New(actualOptions)
 	}
 
-	// Perform synchronization
-	if err := syncer.Sync(config.Source, config.Destination); err != nil {
-		log.Fatalf("Synchronization failed: %v", err)
+	// Perform synchronization, showing its progress on standard error
+	var metrics *metricsServer
+	if config.MetricsListen != "" {
+		if metrics, err = startMetricsServer(syncer, config.MetricsListen, logger); err != nil {
+			log.Fatalf("Failed to serve metrics: %v", err)
+		}
+	}
+	ctx, stopSignals := interruptContext(logger)
+	defer stopSignals()
+	var display *progressDisplay
+	if config.Progress {
+		display = startProgress(syncer, os.Stderr)
+	}
+	var syncErr error
+	if config.Watch {
+		// Watch mode runs until it is stopped, which is how it ends normally
+		syncErr = syncer.Watch(ctx, config.Source, config.Destination)
+		if errors.Is(syncErr, errInterrupted) {
+			logger.Info("Stopped watching", "reason", syncErr)
+			syncErr = nil
+		}
+	} else {
+		syncErr = syncer.SyncContext(ctx, config.Source, config.Destination)
+	}
+	if display != nil {
+		display.Stop()
+	}
+	if metrics != nil {
+		metrics.Stop()
+	}
+
+	// Metrics are written even if the sync failed, to alert on it
+	if config.MetricsFile != "" {
+		if err := syncer.WriteMetricsFile(config.MetricsFile); err != nil {
+			log.Fatalf("Failed to write metrics file: %v", err)
+		}
+	}
+
+	// The report is written even if the sync failed
+	if config.Report != "" {
+		if err := writeReport(syncer.Report(), config.ReportFile); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+
+	if errors.Is(syncErr, errInterrupted) {
+		log.Printf("Synchronization %v", syncErr)
+		os.Exit(exitInterrupted)
+	}
+	if syncErr != nil {
+		log.Fatalf("Synchronization failed: %v", syncErr)
+	}
+
+	stats := syncer.Stats()
+	if code := exitCode(stats); code != exitOK {
+		log.Printf("Synchronization finished with %d errors", len(stats.FileErrors))
+		os.Exit(code)
 	}
 
 	if config.Verbose {
@@ -132,6 +328,19 @@ func main() {
 	}
 }
 
+// exitCode returns the exit code of a sync that ran to the end with stats
+func exitCode(stats sync.Stats) int {
+	if len(stats.FileErrors) == 0 {
+		return exitOK
+	}
+	for _, record := range stats.FileErrors {
+		if record.Class != sync.ErrorClassNotFound {
+			return exitPartial
+		}
+	}
+	return exitVanished
+}
+
 func parseFlags() Config {
 	config := Config{
 		Threads: 4,       // Default number of threads
@@ -151,13 +360,68 @@ func parseFlags() Config {
 	flag.BoolVar(&config.Interactive, "i", false, "Interactive mode (short)")
 	flag.BoolVar(&config.Verbose, "verbose", false, "Verbose output")
 	flag.BoolVar(&config.Verbose, "v", false, "Verbose output (short)")
+	flag.StringVar(&config.LogLevel, "log-level", "", "Log level: debug, info, warn, error (default: info with --verbose, warn otherwise)")
+	flag.StringVar(&config.LogFormat, "log-format", "text", "Log format: text, json")
+	flag.BoolVar(&config.Progress, "progress", false, "Show progress with throughput and ETA")
+	flag.BoolVar(&config.Itemize, "itemize", false, "Print a change summary line for every changed file")
+	flag.BoolVar(&config.Itemize, "itemize-changes", false, "Print a change summary line for every changed file (alias for --itemize)")
 	flag.BoolVar(&config.Recursive, "recursive", true, "Recursively sync directories")
 	flag.BoolVar(&config.Recursive, "r", true, "Recursive (short)")
 	flag.BoolVar(&config.Delete, "delete", false, "Delete extraneous files from destination")
 	flag.IntVar(&config.Threads, "threads", 4, "Number of concurrent threads")
 	flag.IntVar(&config.Threads, "j", 4, "Number of threads (short)")
 	flag.StringVar(&config.Method, "method", "mtime", "Comparison method: mtime, checksum, size")
+	flag.StringVar(&config.ChecksumAlgo, "checksum-algo", sync.DefaultChecksumAlgo, "Checksum algorithm: "+strings.Join(sync.ChecksumAlgorithms(), ", "))
 	flag.BoolVar(&config.SkipBrokenLinks, "skip-broken-links", false, "Skip broken symbolic links entirely")
+	flag.BoolVar(&config.Links, "links", false, "Copy symlinks as symlinks")
+	flag.BoolVar(&config.Links, "l", false, "Copy symlinks as symlinks (short)")
+	flag.BoolVar(&config.CopyLinks, "copy-links", false, "Replace symlinks with the files and directories they point to")
+	flag.BoolVar(&config.CopyLinks, "L", false, "Replace symlinks with their referents (short)")
+	flag.BoolVar(&config.SafeLinks, "safe-links", false, "Skip symlinks that point outside the source tree")
+	flag.BoolVar(&config.RewriteLinks, "rewrite-links", false, "Rewrite absolute symlinks into the source tree as relative links")
+	flag.BoolVar(&config.Archive, "archive", false, "Archive mode: recursive, preserve links, permissions, directory times and ownership")
+	flag.BoolVar(&config.Archive, "a", false, "Archive mode (short)")
+	flag.BoolVar(&config.Perms, "perms", false, "Preserve permissions")
+	flag.BoolVar(&config.Perms, "p", false, "Preserve permissions (short)")
+	flag.BoolVar(&config.DirTimes, "dir-times", false, "Preserve directory modification times")
+	flag.BoolVar(&config.Owner, "owner", false, "Preserve owner (requires root)")
+	flag.BoolVar(&config.Owner, "o", false, "Preserve owner (short)")
+	flag.BoolVar(&config.Group, "group", false, "Preserve group")
+	flag.BoolVar(&config.Group, "g", false, "Preserve group (short)")
+	flag.BoolVar(&config.HardLinks, "hard-links", false, "Preserve hard links")
+	flag.BoolVar(&config.HardLinks, "H", false, "Preserve hard links (short)")
+	flag.BoolVar(&config.Xattrs, "xattrs", false, "Preserve extended attributes")
+	flag.BoolVar(&config.Xattrs, "X", false, "Preserve extended attributes (short)")
+	flag.BoolVar(&config.ACLs, "acls", false, "Preserve POSIX ACLs")
+	flag.BoolVar(&config.ACLs, "A", false, "Preserve POSIX ACLs (short)")
+	flag.BoolVar(&config.Sparse, "sparse", false, "Recreate holes of sparse files")
+	flag.BoolVar(&config.Sparse, "S", false, "Recreate holes of sparse files (short)")
+	flag.BoolVar(&config.NumericIDs, "numeric-ids", false, "Restore TAR ownership by uid/gid instead of user and group names")
+	flag.BoolVar(&config.Delta, "delta", false, "Update changed files with a rolling-checksum delta")
+	flag.BoolVar(&config.Partial, "partial", false, "Keep partially transferred files and resume them")
+	flag.StringVar(&config.CacheDir, "cache-dir", "", "Cache checksums in DIR, so unchanged files are not hashed again")
+	flag.BoolVar(&config.Rehash, "rehash", false, "Ignore cached checksums and hash every file again")
+	flag.BoolVar(&config.Verify, "verify", false, "Read back copied files and compare them to the source")
+	flag.StringVar(&config.Report, "report", "", "Write a report of the sync in FORMAT (json)")
+	flag.StringVar(&config.ReportFile, "report-file", "", "Write the report to PATH instead of standard output")
+	flag.StringVar(&config.BwLimit, "bwlimit", "", "Limit copies to RATE bytes per second (suffixes K, M, G)")
+	flag.StringVar(&config.BwSchedule, "bwlimit-schedule", "", "Daily bandwidth limits such as 08:00=20M,19:00=0 (overrides --bwlimit)")
+	flag.Float64Var(&config.FilesPerSecond, "files-per-second", 0, "Limit the files written or deleted per second")
+	flag.BoolVar(&config.Watch, "watch", false, "Keep watching the source and sync its changes until interrupted")
+	flag.DurationVar(&config.WatchDebounce, "watch-debounce", 2*time.Second, "With --watch, wait for DURATION without changes before syncing them")
+	flag.DurationVar(&config.WatchRescan, "watch-rescan", time.Hour, "With --watch, run a full sync every DURATION to catch missed changes (0 disables)")
+	flag.IntVar(&config.MaxErrors, "max-errors", 0, "Abort the sync after N errors (0 = no limit)")
+	flag.StringVar(&config.MetricsFile, "metrics-file", "", "Write Prometheus metrics of the sync to PATH for the node_exporter textfile collector")
+	flag.StringVar(&config.MetricsListen, "metrics-listen", "", "Serve Prometheus metrics at /metrics on ADDR while syncing")
+	flag.IntVar(&config.DeltaBlockSize, "block-size", 0, "Block size in bytes for delta transfer (default: auto)")
+	// Filter rules share one list so their command-line order is kept
+	flag.Var(filterFlag{rules: &config.FilterRules, prefix: "+ "}, "include", "Include files matching PATTERN (repeatable)")
+	flag.Var(filterFlag{rules: &config.FilterRules, prefix: "- "}, "exclude", "Exclude files matching PATTERN (repeatable)")
+	flag.Var(excludeFromFlag{rules: &config.FilterRules}, "exclude-from", "Read exclude patterns from FILE (repeatable)")
+	flag.Var(filterFlag{rules: &config.FilterRules}, "filter", "Add a filter RULE such as '- *.pyc' or '+ /keep/' (repeatable)")
+	flag.BoolVar(&config.DeleteExcluded, "delete-excluded", false, "Also delete excluded files from destination")
+	flag.BoolVar(&config.GitIgnore, "gitignore", false, "Honor per-directory .gitignore files")
+	flag.Var(filterFlag{rules: &config.IgnoreFiles}, "ignore-file", "Honor per-directory ignore files named NAME (repeatable)")
 	// TAR-specific flags
 	flag.BoolVar(&config.TarCompress, "tar-compress", false, "Use gzip compression for TAR files")
 	flag.BoolVar(&config.GPGEncrypt, "gpg-encrypt", false, "Encrypt TAR files with GPG")
@@ -180,6 +444,11 @@ func parseFlags() Config {
 		config.Destination = args[1]
 	}
 
+	// A report file without a format gets the only format there is
+	if config.ReportFile != "" && config.Report == "" {
+		config.Report = "json"
+	}
+
 	// If --checksum flag is used, automatically set method to checksum
 	if config.Checksum && config.Method == "mtime" {
 		config.Method = "checksum"
@@ -188,6 +457,75 @@ func parseFlags() Config {
 	return config
 }
 
+// interruptContext returns a context that is cancelled with errInterrupted
+// by the first SIGINT or SIGTERM, so the sync stops gracefully. A second
+// signal exits at once. The returned function stops listening for signals.
+func interruptContext(logger *slog.Logger) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		logger.Warn("Stopping the sync, signal again to exit immediately", "signal", sig.String())
+		cancel(fmt.Errorf("%w (%s)", errInterrupted, sig))
+		if _, ok := <-signals; ok {
+			os.Exit(exitInterrupted)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+// newLogger returns the logger for the log level and format of config.
+// Logs go to standard error, keeping standard output for the summary,
+// itemized changes and reports.
+func newLogger(config Config) (*slog.Logger, error) {
+	level := slog.LevelWarn
+	if config.Verbose {
+		level = slog.LevelInfo
+	}
+	if config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", config.LogLevel)
+		}
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	switch config.LogFormat {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(os.Stderr, handlerOptions)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", config.LogFormat)
+	}
+}
+
+// writeReport writes report as JSON to path, or to standard output if path
+// is empty
+func writeReport(report sync.Report, path string) error {
+	if path == "" {
+		return report.WriteJSON(os.Stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteJSON(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 func printUsage() {
 	fmt.Printf(`msync v%s - Fast file synchronization tool
 
@@ -199,8 +537,13 @@ Examples:
   msync /home/user/docs /backup/docs
   msync -c -v /src /dst                    # Use checksum with verbose output
   msync --plan --delete /src /dst          # Preview sync with deletion
+  msync --plan --itemize /src /dst         # List planned changes with their reasons
   msync -i /src /dst                       # Interactive mode with preview
   msync -j 8 --method checksum /src /dst   # Use 8 threads with checksum
+  msync -c --checksum-algo xxh64 /src /dst # Checksum with a fast non-cryptographic hash
+  msync --exclude node_modules/ --exclude '*.pyc' /src /dst
+  msync -a --delete /src /dst              # Mirror with links, permissions and ownership
+  msync --watch --delete /src /dst         # Keep the destination in sync as the source changes
 
 Options:
   -s, --source PATH       Source directory or file
@@ -210,17 +553,88 @@ Options:
       --plan              Preview changes without executing (same as --dry-run)
   -i, --interactive       Show preview and ask for confirmation before proceeding
   -v, --verbose           Enable verbose output
+      --progress          Show progress, throughput, ETA and the files being copied
+      --itemize           Print a change summary line for every changed file (see below)
+      --log-level LEVEL   Log level: debug, info, warn, error (default: info with -v, warn otherwise)
+      --log-format FMT    Log format written to standard error: text, json (default: text)
   -r, --recursive         Sync directories recursively (default: true)
       --delete            Delete files in destination not present in source
   -j, --threads N         Number of concurrent threads (default: 4)
       --method METHOD     Comparison method: mtime, checksum, size (default: mtime)
+      --checksum-algo ALG Checksum algorithm: sha256, sha512, blake2b, xxh64, xxh3, crc32c (default: sha256)
+      --cache-dir DIR     Cache checksums in DIR, so unchanged files are not hashed again
+      --rehash            Ignore cached checksums and hash every file again
       --skip-broken-links Skip broken symbolic links entirely
+  -l, --links             Copy symlinks as symlinks
+  -L, --copy-links        Replace symlinks with the files and directories they point to
+      --safe-links        Skip symlinks that point outside the source tree
+      --rewrite-links     Rewrite absolute symlinks into the source tree as relative links
+  -a, --archive           Archive mode; same as -r -l -p -o -g --dir-times
+  -p, --perms             Preserve permissions, including setuid, setgid and sticky bits
+      --dir-times         Preserve directory modification times
+  -o, --owner             Preserve owner (super-user only)
+  -g, --group             Preserve group
+  -H, --hard-links        Copy hard-linked files once and recreate their other names as links
+  -X, --xattrs            Preserve extended attributes (Linux)
+  -A, --acls              Preserve POSIX ACLs (Linux)
+  -S, --sparse            Recreate holes of sparse files instead of writing zeros
+      --numeric-ids       Restore TAR ownership by uid/gid instead of user and group names
+      --delta             Transfer only changed blocks of existing files
+      --block-size N      Block size in bytes for --delta (default: auto)
+      --partial           Keep partially transferred files and resume them on the next run
+      --verify            Read back each copied file, compare it to the source and retry on mismatch
+      --watch             After the first sync, watch the source and sync its changes until interrupted
+      --watch-debounce D  With --watch, wait D without changes before syncing them (default: 2s)
+      --watch-rescan D    With --watch, run a full sync every D to catch missed changes (default: 1h, 0 disables)
+      --max-errors N      Abort the sync after N errors (default: 0, no limit)
+      --bwlimit RATE      Limit copies to RATE bytes per second, shared by all threads (e.g. 20M)
+      --bwlimit-schedule SPEC Daily limits such as 08:00=20M,19:00=0, applied as the time of day changes
+      --files-per-second N Limit the files written or deleted per second
+      --report FORMAT     Write a report of every action, error and statistic (json)
+      --report-file PATH  Write the report to PATH instead of standard output (implies --report json)
+      --metrics-file PATH Write Prometheus metrics to PATH after the sync (node_exporter textfile)
+      --metrics-listen ADDR Serve Prometheus metrics at http://ADDR/metrics during the sync
   -h, --help              Show this help message
       --version           Show version information
 
+Filtering:
+      --include PATTERN   Include files matching PATTERN
+      --exclude PATTERN   Exclude files matching PATTERN
+      --exclude-from FILE Read exclude patterns from FILE
+      --filter RULE       Add a filter rule ('+ PATTERN' or '- PATTERN')
+      --delete-excluded   Also delete excluded files from destination
+      --gitignore         Honor per-directory .gitignore files
+      --ignore-file NAME  Honor per-directory ignore files named NAME
+
+  Rules are checked in command-line order and the first match wins.
+  PATTERN supports *, ?, [...] and ** globs; a leading / anchors it to the
+  root of the tree and a trailing / matches directories only. Excluded
+  destination files are protected from --delete unless --delete-excluded.
+
+  Per-directory .msyncignore files are always honored and use gitignore
+  syntax, including '!' negation. Their rules apply to the directory they
+  are in and all of its subdirectories, with deeper files taking precedence.
+  Command-line rules are checked before any ignore file.
+
+Itemized Changes:
+  --itemize prints one line per change, in the format of rsync --itemize-changes:
+    >f.st...... docs/report.pdf     YXcstpoguax PATH
+  Y is the update: > transfer, c local create, h hard link, . attributes only;
+  *deleting marks deletions. X is f for files, d for directories, L for links.
+  Then: c checksum, s size, t mtime, p permissions, o owner, g group, a ACLs,
+  x xattrs differ; + marks a new entry and . an unchanged attribute.
+
+Exit Codes:
+  0   All files were synced
+  1   The sync could not run, failed or was aborted by --max-errors
+  20  The sync was stopped by SIGINT or SIGTERM (in --watch mode, the errors
+      of all its syncs decide the exit code instead)
+  23  Some files failed to sync (permission denied, disk full, checksum mismatch...)
+  24  Only source files that vanished during the sync failed
+
 Comparison Methods:
   mtime    - Compare by modification time (fastest)
-  checksum - Compare by SHA256 hash (most accurate)
+  checksum - Compare by content hash, SHA256 unless --checksum-algo is set (most accurate)
   size     - Compare by file size (fast but less reliable)
 
 TAR Archive Support:
@@ -240,6 +654,41 @@ TAR Examples:
 `, version)
 }
 
+// filterFlag appends flag values to an ordered list of filter rules
+type filterFlag struct {
+	rules  *[]string
+	prefix string // Rule prefix added to each value ("+ ", "- " or none)
+}
+
+func (f filterFlag) String() string {
+	return ""
+}
+
+func (f filterFlag) Set(value string) error {
+	*f.rules = append(*f.rules, f.prefix+value)
+	return nil
+}
+
+// excludeFromFlag appends exclude rules read from a pattern file
+type excludeFromFlag struct {
+	rules *[]string
+}
+
+func (f excludeFromFlag) String() string {
+	return ""
+}
+
+func (f excludeFromFlag) Set(path string) error {
+	patterns, err := filter.ReadPatternFile(path)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		*f.rules = append(*f.rules, "- "+pattern)
+	}
+	return nil
+}
+
 // askForConfirmation prompts the user for confirmation
 func askForConfirmation() bool {
 	fmt.Print("\n❓ Do you want to proceed with these changes? [y/N]: ")
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/osmontero/msync/pkg/sync"
+)
+
+// metricsServer serves the metrics of a running sync over HTTP
+type metricsServer struct {
+	server *http.Server
+	done   chan struct{}
+}
+
+// startMetricsServer serves the metrics of syncer at /metrics on addr.
+// Errors after the server has started are logged to logger.
+func startMetricsServer(syncer *sync.Syncer, addr string, logger *slog.Logger) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sync.MetricsContentType)
+		syncer.WriteMetrics(w)
+	})
+
+	m := &metricsServer{
+		server: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(m.done)
+		if err := m.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", "error", err)
+		}
+	}()
+	return m, nil
+}
+
+// Stop shuts the server down
+func (m *metricsServer) Stop() {
+	m.server.Close()
+	<-m.done
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/osmontero/msync/internal/utils"
+	"github.com/osmontero/msync/pkg/sync"
+)
+
+const (
+	progressInterval    = 500 * time.Millisecond // Redraw interval on a terminal
+	progressLogInterval = 10 * time.Second       // Interval of progress lines otherwise
+	progressPathWidth   = 50                     // Longest path shown for an active file
+	rateSmoothing       = 0.3                    // Weight of the newest sample in the rates
+)
+
+// progressDisplay shows the progress of a running sync. On a terminal it
+// is redrawn in place, one status line plus a line per active file; on
+// other output a status line is printed periodically.
+type progressDisplay struct {
+	syncer *sync.Syncer
+	out    *os.File
+	tty    bool
+	lines  int // Lines drawn by the last update on a terminal
+
+	lastSample      time.Time
+	lastTransferred int64
+	lastDone        int64
+	rate            float64 // Smoothed bytes transferred per second
+	doneRate        float64 // Smoothed bytes done per second, skipped files included
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startProgress starts displaying the progress of syncer on out
+func startProgress(syncer *sync.Syncer, out *os.File) *progressDisplay {
+	d := &progressDisplay{
+		syncer:     syncer,
+		out:        out,
+		tty:        isTerminal(out),
+		lastSample: time.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Stop shows the final progress and stops the display
+func (d *progressDisplay) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *progressDisplay) run() {
+	defer close(d.done)
+
+	interval := progressLogInterval
+	if d.tty {
+		interval = progressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.update(false)
+		case <-d.stop:
+			d.update(true)
+			return
+		}
+	}
+}
+
+// update samples the progress of the sync and shows it
+func (d *progressDisplay) update(final bool) {
+	progress := d.syncer.Progress()
+
+	now := time.Now()
+	if seconds := now.Sub(d.lastSample).Seconds(); seconds > 0 {
+		done := progress.CurrentBytesDone()
+		d.rate = smooth(d.rate, float64(progress.BytesTransferred-d.lastTransferred)/seconds)
+		d.doneRate = smooth(d.doneRate, float64(done-d.lastDone)/seconds)
+		d.lastSample, d.lastTransferred, d.lastDone = now, progress.BytesTransferred, done
+	}
+
+	status := d.statusLine(progress, final)
+	if !d.tty {
+		fmt.Fprintln(d.out, status)
+		return
+	}
+
+	lines := []string{status}
+	if !final {
+		for _, file := range progress.Active {
+			lines = append(lines, activeLine(file))
+		}
+	}
+
+	// Move back to the first line of the last update and clear everything
+	// below it before drawing
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+	b.WriteString("\r\033[J")
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	d.out.WriteString(b.String())
+	d.lines = len(lines)
+}
+
+// statusLine describes the overall progress of the sync
+func (d *progressDisplay) statusLine(progress sync.Progress, final bool) string {
+	more := ""
+	if !progress.ScanDone {
+		more = "+"
+	}
+
+	eta := "scanning"
+	switch {
+	case final:
+		eta = "in " + utils.FormatDuration(progress.Elapsed.Seconds())
+	case progress.ScanDone && d.doneRate > 0:
+		remaining := float64(progress.BytesTotal - progress.CurrentBytesDone())
+		eta = "ETA " + utils.FormatDuration(max(remaining, 0)/d.doneRate)
+	case progress.ScanDone:
+		eta = "ETA unknown"
+	}
+
+	rate := d.rate
+	if final && progress.Elapsed > 0 {
+		rate = float64(progress.BytesTransferred) / progress.Elapsed.Seconds()
+	}
+
+	return fmt.Sprintf("%5.1f%%  %s / %s%s  %d / %d%s files  %s/s  %s",
+		progress.Fraction()*100,
+		utils.FormatBytes(progress.CurrentBytesDone()), utils.FormatBytes(progress.BytesTotal), more,
+		progress.FilesDone, progress.FilesTotal, more,
+		utils.FormatBytes(int64(rate)), eta)
+}
+
+// activeLine describes a file that is being copied
+func activeLine(file sync.ActiveFile) string {
+	path := file.Path
+	if len(path) > progressPathWidth {
+		path = "..." + path[len(path)-progressPathWidth+3:]
+	}
+
+	percent := 100.0
+	if file.Size > 0 {
+		percent = min(float64(file.Done)*100/float64(file.Size), 100)
+	}
+	return fmt.Sprintf("  [%d] %-*s %5.1f%% of %s", file.Slot+1, progressPathWidth, path, percent, utils.FormatBytes(file.Size))
+}
+
+// smooth adds a sample to an exponentially weighted moving average
+func smooth(average, sample float64) float64 {
+	if average == 0 {
+		return sample
+	}
+	return rateSmoothing*sample + (1-rateSmoothing)*average
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -1,3 +1,14 @@
 module github.com/osmontero/msync
 
 go 1.24.7
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/zeebo/xxh3 v1.1.0
+	golang.org/x/crypto v0.45.0
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
@@ -0,0 +1,19 @@
+//go:build darwin
+
+package utils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// ChangeTime returns the inode change time of a file, or the zero time if
+// it is not available
+func ChangeTime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(stat.Ctimespec.Sec, stat.Ctimespec.Nsec)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// ChangeTime returns the inode change time of a file. It is not available
+// on this platform, so the zero time is returned.
+func ChangeTime(info os.FileInfo) time.Time {
+	return time.Time{}
+}
@@ -0,0 +1,17 @@
+//go:build linux && (amd64 || arm64)
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// fadvDontNeed is POSIX_FADV_DONTNEED
+const fadvDontNeed = 4
+
+// DropCache asks the kernel to evict the cached pages of f, so that reading
+// it again fetches the data from the device. It is best effort.
+func DropCache(f *os.File) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, fadvDontNeed, 0, 0)
+}
@@ -0,0 +1,8 @@
+//go:build !linux || !(amd64 || arm64)
+
+package utils
+
+import "os"
+
+// DropCache is a no-op on platforms without posix_fadvise support here
+func DropCache(f *os.File) {}
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // FormatBytes converts bytes to human readable format
@@ -39,3 +42,32 @@ func FormatDuration(seconds float64) string {
 
 	return fmt.Sprintf("%dh %dm %.1fs", hours, minutes, secs)
 }
+
+// ParseBytes parses a byte count such as "4096", "512K", "20M", "20MB" or
+// "1.5GiB". Suffixes are case-insensitive and, like FormatBytes, use powers
+// of 1024.
+func ParseBytes(s string) (int64, error) {
+	number := strings.TrimSpace(s)
+	upper := strings.ToUpper(number)
+	for _, suffix := range []string{"IB", "B"} {
+		if strings.HasSuffix(upper, suffix) {
+			upper = strings.TrimSuffix(upper, suffix)
+			break
+		}
+	}
+	number = number[:len(upper)]
+
+	multiplier := 1.0
+	if n := len(number); n > 0 {
+		if i := strings.IndexByte("KMGTP", upper[n-1]); i >= 0 {
+			multiplier = math.Pow(1024, float64(i+1))
+			number = number[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid byte count %q", s)
+	}
+	return int64(value * multiplier), nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"512k", 512 << 10},
+		{"20M", 20 << 20},
+		{"20MB", 20 << 20},
+		{"20mib", 20 << 20},
+		{"1.5G", 3 << 29},
+		{" 2T ", 2 << 40},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.input)
+		if err != nil {
+			t.Errorf("ParseBytes(%q) failed: %v", tt.input, err)
+		} else if got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "M", "-1K", "20X", "fast"} {
+		if _, err := ParseBytes(input); err == nil {
+			t.Errorf("ParseBytes(%q) succeeded, want an error", input)
+		}
+	}
+}
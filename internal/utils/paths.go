@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IsUnsafeLink reports whether a symlink at linkPath, relative to the root of
+// a tree, with the given target would point outside of that tree. Absolute
+// targets are always considered unsafe.
+func IsUnsafeLink(linkPath, target string) bool {
+	if target == "" || filepath.IsAbs(target) {
+		return true
+	}
+
+	// Count directory depth below the root, starting from the link's parent
+	depth := 0
+	if dir := filepath.Dir(filepath.Clean(linkPath)); dir != "." {
+		depth = len(strings.Split(filepath.ToSlash(dir), "/"))
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+
+	return false
+}
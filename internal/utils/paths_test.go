@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestIsUnsafeLink(t *testing.T) {
+	tests := []struct {
+		link   string
+		target string
+		want   bool
+	}{
+		{"a", "b", false},
+		{"a", "sub/b", false},
+		{"dir/a", "../b", false},
+		{"a", "../b", true},
+		{"dir/a", "../../b", true},
+		{"a", "sub/../../b", true},
+		{"dir/sub/a", "../x/../../y", false},
+		{"a", "/etc/passwd", true},
+		{"a", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsUnsafeLink(tt.link, tt.target); got != tt.want {
+			t.Errorf("IsUnsafeLink(%q, %q): expected %t, got %t", tt.link, tt.target, tt.want, got)
+		}
+	}
+}
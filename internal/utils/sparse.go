@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the granularity at which zero data becomes a hole
+const sparseBlockSize = 4096
+
+// Extent is a region of a file that holds data
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// SparseWriter writes sequentially to a file, turning blocks of zero bytes
+// into holes instead of writing them. Close must be called to set the final
+// file size.
+type SparseWriter struct {
+	file   *os.File
+	offset int64
+}
+
+// NewSparseWriter returns a SparseWriter that writes to file from its start
+func NewSparseWriter(file *os.File) *SparseWriter {
+	return &SparseWriter{file: file}
+}
+
+// Write writes p at the current offset, skipping all-zero blocks
+func (w *SparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Split at block boundaries so holes stay block aligned
+		n := sparseBlockSize - int(w.offset%sparseBlockSize)
+		if n > len(p) {
+			n = len(p)
+		}
+		chunk := p[:n]
+
+		if !isZero(chunk) {
+			if _, err := w.file.WriteAt(chunk, w.offset); err != nil {
+				return written, err
+			}
+		}
+
+		w.offset += int64(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Skip advances the offset to off, leaving a hole over the skipped range
+func (w *SparseWriter) Skip(off int64) {
+	if off > w.offset {
+		w.offset = off
+	}
+}
+
+// Close sets the file size to the final offset, which creates any trailing
+// hole. It does not close the underlying file.
+func (w *SparseWriter) Close() error {
+	return w.file.Truncate(w.offset)
+}
+
+// isZero reports whether b consists of zero bytes only
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CopySparse copies src to a SparseWriter on dst, reading only the data
+// extents of src, and returns the number of bytes of data read. If sum is
+// not nil, the full content of src is written to it, with zeros for holes.
+// If read is not nil, only the data read from src is written to it.
+func CopySparse(dst *os.File, src *os.File, size int64, sum, read io.Writer) (int64, error) {
+	extents, err := SparseExtents(src, size)
+	if err != nil {
+		return 0, err
+	}
+
+	w := NewSparseWriter(dst)
+	var copied, pos int64
+	for _, extent := range extents {
+		w.Skip(extent.Offset)
+		var data io.Reader = io.NewSectionReader(src, extent.Offset, extent.Length)
+		if read != nil {
+			data = io.TeeReader(data, read)
+		}
+		if sum != nil {
+			if err := writeZeros(sum, extent.Offset-pos); err != nil {
+				return copied, err
+			}
+			data = io.TeeReader(data, sum)
+		}
+		n, err := io.Copy(w, data)
+		copied += n
+		pos = extent.Offset + n
+		if err != nil {
+			return copied, err
+		}
+	}
+	w.Skip(size)
+	if sum != nil {
+		if err := writeZeros(sum, size-pos); err != nil {
+			return copied, err
+		}
+	}
+
+	return copied, w.Close()
+}
+
+// writeZeros writes n zero bytes to w
+func writeZeros(w io.Writer, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	zeros := make([]byte, min(n, 32*1024))
+	for n > 0 {
+		written, err := w.Write(zeros[:min(n, int64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		n -= int64(written)
+	}
+	return nil
+}
+
+// dataSize returns the total length of extents
+func dataSize(extents []Extent) int64 {
+	var total int64
+	for _, extent := range extents {
+		total += extent.Length
+	}
+	return total
+}
+
+// HasHoles reports whether extents cover less than size bytes
+func HasHoles(extents []Extent, size int64) bool {
+	return dataSize(extents) < size
+}
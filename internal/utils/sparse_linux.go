@@ -0,0 +1,51 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lseek whence values for locating data and holes
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// SparseExtents returns the regions of f that hold data, as reported by the
+// file system. Files on file systems without hole reporting are returned as
+// a single extent.
+func SparseExtents(f *os.File, size int64) ([]Extent, error) {
+	var extents []Extent
+	for offset := int64(0); offset < size; {
+		data, err := f.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // Only a hole remains
+		}
+		if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return []Extent{{Offset: 0, Length: size}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		if hole > data {
+			extents = append(extents, Extent{Offset: data, Length: hole - data})
+		}
+		offset = hole
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return extents, nil
+}
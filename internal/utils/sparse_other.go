@@ -0,0 +1,15 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+// SparseExtents returns the regions of f that hold data. Holes cannot be
+// located on this platform, so the whole file is a single extent; zero
+// blocks still become holes when written through a SparseWriter.
+func SparseExtents(f *os.File, size int64) ([]Extent, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return []Extent{{Offset: 0, Length: size}}, nil
+}
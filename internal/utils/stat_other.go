@@ -0,0 +1,11 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+// FileID returns the device and inode numbers of a file and its number of
+// hard links. Inodes are not available on this platform.
+func FileID(info os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
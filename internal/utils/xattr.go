@@ -0,0 +1,28 @@
+package utils
+
+// POSIX ACLs are stored by Linux as extended attributes with these names
+const (
+	ACLAccessXattr  = "system.posix_acl_access"
+	ACLDefaultXattr = "system.posix_acl_default"
+)
+
+// IsACLXattr reports whether an extended attribute holds a POSIX ACL
+func IsACLXattr(name string) bool {
+	return name == ACLAccessXattr || name == ACLDefaultXattr
+}
+
+// SelectXattrs returns the attributes of attrs that are preserved with the
+// given options: POSIX ACLs with acls, all other attributes with xattrs
+func SelectXattrs(attrs map[string][]byte, xattrs, acls bool) map[string][]byte {
+	var selected map[string][]byte
+	for name, value := range attrs {
+		if IsACLXattr(name) && !acls || !IsACLXattr(name) && !xattrs {
+			continue
+		}
+		if selected == nil {
+			selected = make(map[string][]byte)
+		}
+		selected[name] = value
+	}
+	return selected
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// Xattrs returns the extended attributes of a file. File systems without
+// extended attribute support yield an empty set.
+func Xattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if isXattrUnsupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		value, err := getXattr(path, name)
+		if err != nil {
+			if errors.Is(err, syscall.ENODATA) {
+				continue // Removed since it was listed
+			}
+			return nil, err
+		}
+		attrs[name] = value
+	}
+	return attrs, nil
+}
+
+// getXattr reads a single extended attribute
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size == 0 {
+		return value, nil
+	}
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// SetXattr sets an extended attribute of a file
+func SetXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
+
+// RemoveXattr removes an extended attribute from a file
+func RemoveXattr(path, name string) error {
+	err := syscall.Removexattr(path, name)
+	if errors.Is(err, syscall.ENODATA) {
+		return nil
+	}
+	return err
+}
+
+// isXattrUnsupported reports whether err means the file system does not
+// support extended attributes
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP)
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package utils
+
+import "errors"
+
+// errXattrUnsupported is returned when extended attributes cannot be written
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// Xattrs returns the extended attributes of a file. Extended attributes are
+// not supported on this platform, so the set is always empty.
+func Xattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// SetXattr sets an extended attribute of a file
+func SetXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+// RemoveXattr removes an extended attribute from a file
+func RemoveXattr(path, name string) error {
+	return errXattrUnsupported
+}
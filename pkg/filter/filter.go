@@ -0,0 +1,290 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Action is what happens to a path matched by a rule
+type Action int
+
+const (
+	Exclude Action = iota // Leave the path out of the sync
+	Include               // Keep the path in the sync
+)
+
+// Rule is a single include or exclude pattern
+type Rule struct {
+	Action   Action
+	Pattern  string // Pattern as written by the user
+	Anchored bool   // Pattern is matched from the root of the tree only
+	DirOnly  bool   // Pattern only matches directories
+	Base     string // Directory the pattern is relative to ("" for the root)
+	re       *regexp.Regexp
+}
+
+// Filter holds an ordered list of rules. The first rule matching a path
+// decides whether it is included or excluded; paths matching no rule are
+// included. A Filter may also name per-directory ignore files, which are
+// honored when walking a tree through a Matcher.
+type Filter struct {
+	rules       []Rule
+	ignoreFiles []string
+}
+
+// New creates an empty filter
+func New() *Filter {
+	return &Filter{}
+}
+
+// Parse builds a filter from rules in rsync filter syntax, e.g. "- *.pyc"
+// or "+ /keep/"
+func Parse(lines []string) (*Filter, error) {
+	f := New()
+	for _, line := range lines {
+		if err := f.AddRule(line); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// NewRule compiles a pattern into a rule.
+//
+// Patterns use glob syntax: "*" matches any run of characters except "/",
+// "?" matches a single character, "[...]" matches a character class and "**"
+// matches across directory levels. A leading "/" anchors the pattern to the
+// root of the tree, otherwise it may match at any depth. A trailing "/" makes
+// the pattern match directories only.
+func NewRule(action Action, pattern string) (Rule, error) {
+	rule := Rule{Action: action, Pattern: pattern}
+
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		rule.DirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.HasPrefix(p, "/") {
+		rule.Anchored = true
+		p = strings.TrimLeft(p, "/")
+	}
+	if p == "" {
+		return Rule{}, fmt.Errorf("empty filter pattern %q", pattern)
+	}
+
+	expr := globToRegexp(p)
+	if rule.Anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "(?:^|/)" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+	}
+	rule.re = re
+
+	return rule, nil
+}
+
+// ParseRule parses a rule in rsync filter syntax: "+ PATTERN" or
+// "include PATTERN" to include, "- PATTERN" or "exclude PATTERN" to exclude
+func ParseRule(line string) (Rule, error) {
+	line = strings.TrimSpace(line)
+
+	prefixes := []struct {
+		prefix string
+		action Action
+	}{
+		{"+ ", Include},
+		{"- ", Exclude},
+		{"include ", Include},
+		{"exclude ", Exclude},
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(line, p.prefix) {
+			return NewRule(p.action, strings.TrimSpace(line[len(p.prefix):]))
+		}
+	}
+
+	return Rule{}, fmt.Errorf("invalid filter rule %q: expected '+ PATTERN' or '- PATTERN'", line)
+}
+
+// Add appends a compiled rule to the filter
+func (f *Filter) Add(rule Rule) {
+	f.rules = append(f.rules, rule)
+}
+
+// AddRule parses and appends a rule in rsync filter syntax
+func (f *Filter) AddRule(line string) error {
+	rule, err := ParseRule(line)
+	if err != nil {
+		return err
+	}
+	f.Add(rule)
+	return nil
+}
+
+// AddInclude appends an include pattern
+func (f *Filter) AddInclude(pattern string) error {
+	rule, err := NewRule(Include, pattern)
+	if err != nil {
+		return err
+	}
+	f.Add(rule)
+	return nil
+}
+
+// AddExclude appends an exclude pattern
+func (f *Filter) AddExclude(pattern string) error {
+	rule, err := NewRule(Exclude, pattern)
+	if err != nil {
+		return err
+	}
+	f.Add(rule)
+	return nil
+}
+
+// Rules returns the rules of the filter in evaluation order
+func (f *Filter) Rules() []Rule {
+	if f == nil {
+		return nil
+	}
+	return f.rules
+}
+
+// Len returns the number of rules in the filter
+func (f *Filter) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.rules)
+}
+
+// Excluded reports whether relPath, relative to the root of the tree, is
+// excluded by the rules of the filter. Ignore files are not consulted; use a
+// Matcher for that. A nil filter excludes nothing.
+func (f *Filter) Excluded(relPath string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	for _, rule := range f.rules {
+		if rule.Match(relPath, isDir) {
+			return rule.Action == Exclude
+		}
+	}
+	return false
+}
+
+// Match reports whether the rule matches a slash-separated relative path
+func (r Rule) Match(relPath string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	if r.Base != "" {
+		if !strings.HasPrefix(relPath, r.Base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.Base)+1:]
+	}
+	return r.re.MatchString(relPath)
+}
+
+// ReadPatternFile reads patterns from a file, one per line. Blank lines and
+// lines starting with '#' or ';' are ignored.
+func ReadPatternFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// globToRegexp translates a glob pattern into an unanchored regular expression
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more leading directories
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			} else {
+				b.WriteString(`\\`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return b.String()
+}
+
+// classEnd returns the index of the ']' closing the character class that
+// starts at start, or -1 if the class is not terminated
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
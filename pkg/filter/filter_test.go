@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.pyc", "main.pyc", false, true},
+		{"*.pyc", "pkg/sub/main.pyc", false, true},
+		{"*.pyc", "main.py", false, false},
+		{"node_modules/", "node_modules", true, true},
+		{"node_modules/", "web/node_modules", true, true},
+		{"node_modules/", "node_modules", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"src/*.go", "src/main.go", false, true},
+		{"src/*.go", "src/pkg/main.go", false, false},
+		{"src/*.go", "repo/src/main.go", false, true},
+		{"/src/**/*.go", "src/main.go", false, true},
+		{"/src/**/*.go", "src/a/b/main.go", false, true},
+		{"/src/**", "src/a/b", false, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file12.txt", false, false},
+		{"[ab]*.log", "access.log", false, true},
+		{"[!ab]*.log", "access.log", false, false},
+		{`\*.txt`, "*.txt", false, true},
+		{`\*.txt`, "a.txt", false, false},
+	}
+
+	for _, tt := range tests {
+		rule, err := NewRule(Exclude, tt.pattern)
+		if err != nil {
+			t.Fatalf("NewRule(%q) failed: %v", tt.pattern, err)
+		}
+		if got := rule.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Pattern %q on %q (dir=%t): expected %t, got %t", tt.pattern, tt.path, tt.isDir, tt.want, got)
+		}
+	}
+}
+
+func TestFilterFirstMatchWins(t *testing.T) {
+	f, err := Parse([]string{
+		"+ keep.log",
+		"- *.log",
+		"include */",
+		"exclude *",
+	})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"keep.log", false, false},
+		{"logs/keep.log", false, false},
+		{"debug.log", false, true},
+		{"subdir", true, false},
+		{"main.go", false, true},
+	}
+
+	for _, tt := range tests {
+		if got := f.Excluded(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Excluded(%q): expected %t, got %t", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	var f *Filter
+	if f.Excluded("anything", false) {
+		t.Error("Nil filter should not exclude anything")
+	}
+	if f.Len() != 0 {
+		t.Error("Nil filter should have no rules")
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, line := range []string{"*.pyc", "+", "- /", "? foo"} {
+		if _, err := ParseRule(line); err == nil {
+			t.Errorf("Expected error for rule %q", line)
+		}
+	}
+}
+
+func TestReadPatternFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludes.txt")
+	content := "# comment\n*.pyc\n\n; another comment\nnode_modules/\r\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	patterns, err := ReadPatternFile(path)
+	if err != nil {
+		t.Fatalf("ReadPatternFile failed: %v", err)
+	}
+
+	want := []string{"*.pyc", "node_modules/"}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Errorf("Expected %v, got %v", want, patterns)
+	}
+}
@@ -0,0 +1,185 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AddIgnoreFile registers the name of a per-directory ignore file, such as
+// ".msyncignore" or ".gitignore". Files registered later take precedence over
+// earlier ones in the same directory.
+func (f *Filter) AddIgnoreFile(name string) {
+	f.ignoreFiles = append(f.ignoreFiles, name)
+}
+
+// IgnoreFiles returns the names of the registered per-directory ignore files
+func (f *Filter) IgnoreFiles() []string {
+	if f == nil {
+		return nil
+	}
+	return f.ignoreFiles
+}
+
+// ParseIgnore reads rules in gitignore syntax. base is the slash-separated
+// directory, relative to the root of the tree, that the rules apply to.
+//
+// Blank lines and lines starting with '#' are ignored, a leading '!' turns
+// the pattern into an include, a trailing '/' matches directories only and a
+// '/' at the beginning or in the middle anchors the pattern to base.
+func ParseIgnore(r io.Reader, base string) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rule, ok, err := parseIgnoreLine(scanner.Text(), base)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// parseIgnoreLine parses one gitignore line; ok is false for blank lines and
+// comments
+func parseIgnoreLine(line, base string) (rule Rule, ok bool, err error) {
+	line = strings.TrimRight(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Rule{}, false, nil
+	}
+
+	action := Exclude
+	if strings.HasPrefix(line, "!") {
+		action = Include
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	// A slash at the beginning or middle anchors the pattern to base
+	pattern := line
+	if strings.Contains(strings.TrimRight(pattern, "/"), "/") && !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+
+	rule, err = NewRule(action, pattern)
+	if err != nil {
+		return Rule{}, false, err
+	}
+	rule.Base = base
+
+	return rule, true, nil
+}
+
+// trimTrailingSpaces removes trailing spaces unless escaped with a backslash
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Matcher applies a Filter while walking a single tree, loading the
+// per-directory ignore files of each directory as it is entered. Rules from
+// ignore files cascade to all subdirectories, and rules in deeper
+// directories take precedence over those of their parents. A Matcher is safe
+// for concurrent use, so separate directories can be entered in parallel.
+type Matcher struct {
+	filter   *Filter
+	root     string
+	mu       sync.RWMutex
+	dirRules map[string][]Rule
+}
+
+// Matcher creates a Matcher for the tree rooted at root. A nil filter
+// yields a Matcher that excludes nothing.
+func (f *Filter) Matcher(root string) *Matcher {
+	return &Matcher{
+		filter:   f,
+		root:     root,
+		dirRules: make(map[string][]Rule),
+	}
+}
+
+// EnterDir loads the ignore files found in relDir, relative to the root of
+// the tree. It must be called for a directory before its contents are
+// checked with Excluded.
+func (m *Matcher) EnterDir(relDir string) error {
+	key := dirKey(relDir)
+	for _, name := range m.filter.IgnoreFiles() {
+		ignorePath := filepath.Join(m.root, filepath.FromSlash(key), name)
+
+		file, err := os.Open(ignorePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open ignore file %s: %w", ignorePath, err)
+		}
+
+		rules, err := ParseIgnore(file, key)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse ignore file %s: %w", ignorePath, err)
+		}
+
+		m.mu.Lock()
+		m.dirRules[key] = append(m.dirRules[key], rules...)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Excluded reports whether relPath is excluded. Filter rules are checked
+// first in order; if none matches, ignore file rules are checked from the
+// deepest directory up, where the last matching rule of a directory wins.
+func (m *Matcher) Excluded(relPath string, isDir bool) bool {
+	if m.filter == nil {
+		return false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	for _, rule := range m.filter.rules {
+		if rule.Match(relPath, isDir) {
+			return rule.Action == Exclude
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for dir := dirKey(path.Dir(relPath)); ; dir = dirKey(path.Dir(dir)) {
+		rules := m.dirRules[dir]
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].Match(relPath, isDir) {
+				return rules[i].Action == Exclude
+			}
+		}
+		if dir == "" {
+			break
+		}
+	}
+
+	return false
+}
+
+// dirKey normalizes a relative directory path, using "" for the root
+func dirKey(relDir string) string {
+	relDir = filepath.ToSlash(relDir)
+	if relDir == "." || relDir == "/" {
+		return ""
+	}
+	return relDir
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnore(t *testing.T) {
+	content := strings.Join([]string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"docs/*.tmp",
+		`\#literal`,
+		"trailing   ",
+	}, "\n")
+
+	rules, err := ParseIgnore(strings.NewReader(content), "sub")
+	if err != nil {
+		t.Fatalf("ParseIgnore failed: %v", err)
+	}
+
+	if len(rules) != 6 {
+		t.Fatalf("Expected 6 rules, got %d", len(rules))
+	}
+
+	if rules[1].Action != Include {
+		t.Error("Expected '!keep.log' to be an include rule")
+	}
+	if !rules[2].DirOnly {
+		t.Error("Expected 'build/' to match directories only")
+	}
+	if !rules[3].Anchored {
+		t.Error("Expected 'docs/*.tmp' to be anchored")
+	}
+	if !rules[4].Match("sub/#literal", false) {
+		t.Error(`Expected '\#literal' to match '#literal'`)
+	}
+	if !rules[5].Match("sub/trailing", false) {
+		t.Error("Expected trailing spaces to be trimmed")
+	}
+
+	for _, rule := range rules {
+		if rule.Base != "sub" {
+			t.Errorf("Expected base 'sub', got %q", rule.Base)
+		}
+	}
+
+	// Anchored rules only match relative to their base directory
+	if !rules[3].Match("sub/docs/a.tmp", false) {
+		t.Error("Expected 'docs/*.tmp' to match sub/docs/a.tmp")
+	}
+	if rules[3].Match("sub/x/docs/a.tmp", false) || rules[3].Match("docs/a.tmp", false) {
+		t.Error("Expected 'docs/*.tmp' to be anchored to sub/")
+	}
+}
+
+func TestMatcherCascade(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		".msyncignore":          "*.log\n/build/\n",
+		"app/.msyncignore":      "!debug.log\nsecret.txt\n",
+		"app/.gitignore":        "debug.log\ncache/\n",
+		"app/nested/.gitignore": "*.txt\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	f, err := Parse([]string{"+ app/nested/keep.txt"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	f.AddIgnoreFile(".gitignore")
+	f.AddIgnoreFile(".msyncignore")
+
+	m := f.Matcher(root)
+	for _, dir := range []string{".", "app", "app/nested"} {
+		if err := m.EnterDir(dir); err != nil {
+			t.Fatalf("EnterDir(%s) failed: %v", dir, err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"error.log", false, true},             // Root rule
+		{"build", true, true},                  // Anchored root rule
+		{"app/build", true, false},             // Anchored rule does not cascade by name
+		{"app/error.log", false, true},         // Root rule cascades
+		{"app/debug.log", false, false},        // .msyncignore overrides .gitignore
+		{"app/cache", true, true},              // .gitignore rule
+		{"app/secret.txt", false, true},        // Directory rule
+		{"other/secret.txt", false, false},     // Sibling is unaffected
+		{"app/nested/notes.txt", false, true},  // Deepest ignore file
+		{"app/nested/keep.txt", false, false},  // Command-line rule wins
+		{"app/nested/readme.md", false, false}, // No rule matches
+		{"app/nested/debug.log", false, false}, // Parent negation cascades
+		{"app/nested/trace.log", false, true},  // Root rule cascades two levels
+	}
+
+	for _, tt := range tests {
+		if got := m.Excluded(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Excluded(%q): expected %t, got %t", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestNilFilterMatcher(t *testing.T) {
+	var f *Filter
+	m := f.Matcher(t.TempDir())
+	if err := m.EnterDir("."); err != nil {
+		t.Fatalf("EnterDir failed: %v", err)
+	}
+	if m.Excluded("anything", false) {
+		t.Error("Matcher of a nil filter should not exclude anything")
+	}
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	tempFilePrefix = ".msync."
+	tempFileSuffix = ".tmp"
+	tempRandomLen  = 16 // Hex digits of the random part of temporary names
+)
+
+// isTempFile reports whether name is exactly of the form of the temporary
+// files created by createTempFile: the prefix, the name of the destination,
+// a dot, the random hex digits and the suffix. Other files that merely
+// start and end alike belong to users.
+func isTempFile(name string) bool {
+	rest, ok := strings.CutPrefix(name, tempFilePrefix)
+	if !ok {
+		return false
+	}
+	rest, ok = strings.CutSuffix(rest, tempFileSuffix)
+	// At least one character of the destination name before the dot
+	if !ok || len(rest) < tempRandomLen+2 || rest[len(rest)-tempRandomLen-1] != '.' {
+		return false
+	}
+	for _, c := range rest[len(rest)-tempRandomLen:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// createTempFile creates a hidden temporary file next to dst. Data is written
+// there first and then renamed over dst by commitTempFile, so readers of dst
+// never observe a partially written file.
+func createTempFile(dst string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name := tempName(dst)
+		// Use 0666 like os.Create so the process umask applies to new files
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return file, err
+	}
+	return nil, fmt.Errorf("failed to find an unused temporary file name for %s", dst)
+}
+
+// tempName returns a random hidden temporary name in the directory of dst
+func tempName(dst string) string {
+	dir, base := filepath.Split(dst)
+	return filepath.Join(dir, fmt.Sprintf("%s%s.%0*x%s", tempFilePrefix, base, tempRandomLen, rand.Uint64(), tempFileSuffix))
+}
+
+// commitTempFile flushes tmp to stable storage and atomically renames it over
+// dst. The temporary file is removed if any step fails.
+func commitTempFile(tmp *os.File, dst string) (err error) {
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", tmpPath, dst, err)
+	}
+
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// discardTempFile closes and removes a temporary file after a failed write
+func discardTempFile(tmp *os.File) {
+	tmp.Close()
+	os.Remove(tmp.Name())
+}
+
+// syncDir flushes a directory entry to disk so a completed rename survives a
+// crash. Errors are ignored as not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// removeStaleTempFile deletes a temporary file left behind by an interrupted
+// previous run. The destination scan calls it for every temporary file it
+// finds; a directory is always read before files are written into it, so
+// the temporary files of the current run are never seen.
+func (s *Syncer) removeStaleTempFile(path string) {
+	s.logAction("Removing stale temporary file", "Would remove stale temporary file", "path", path)
+	if !s.options.DryRun {
+		if err := os.Remove(path); err != nil {
+			s.addError(path, fmt.Errorf("Failed to remove stale temporary file %s: %w", path, err))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitTempFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	dst := filepath.Join(tmpDir, "target.txt")
+
+	if err := os.WriteFile(dst, []byte("old content"), 0600); err != nil {
+		t.Fatalf("Failed to create destination file: %v", err)
+	}
+
+	tmp, err := createTempFile(dst)
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+
+	if !isTempFile(filepath.Base(tmp.Name())) {
+		t.Errorf("Temporary file %s is not recognized by isTempFile", tmp.Name())
+	}
+	if filepath.Dir(tmp.Name()) != tmpDir {
+		t.Errorf("Temporary file should be created next to destination, got %s", tmp.Name())
+	}
+
+	// Without Perms the permissions of the replaced file are kept
+	syncer := New(Options{})
+	if err := syncer.setTempMetadata(tmp, dst, FileInfo{Mode: 0644}); err != nil {
+		t.Fatalf("Failed to set temporary file metadata: %v", err)
+	}
+
+	if _, err := tmp.WriteString("new content"); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	// The destination must still hold the old content until commit
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Failed to read destination file: %v", err)
+	}
+	if string(content) != "old content" {
+		t.Errorf("Destination changed before commit: %q", string(content))
+	}
+
+	if err := commitTempFile(tmp, dst); err != nil {
+		t.Fatalf("Failed to commit temporary file: %v", err)
+	}
+
+	content, err = os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("Failed to read destination file: %v", err)
+	}
+	if string(content) != "new content" {
+		t.Errorf("Expected new content after commit, got %q", string(content))
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Failed to stat destination file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600 to be kept, got %o", info.Mode().Perm())
+	}
+
+	if _, err := os.Stat(tmp.Name()); !os.IsNotExist(err) {
+		t.Error("Temporary file should not exist after commit")
+	}
+}
+
+func TestSyncRemovesStaleTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(destDir, "subdir"), 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+
+	// A user file that only looks like a temporary file is synced
+	for _, name := range []string{"test.txt", ".msync.notes.tmp"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	stale := filepath.Join(destDir, "subdir", ".msync.test.txt.0123456789abcdef.tmp")
+	if err := os.WriteFile(stale, []byte("partial"), 0644); err != nil {
+		t.Fatalf("Failed to create stale temporary file: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Stale temporary file should have been removed")
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, ".msync.notes.tmp")); err != nil || string(content) != ".msync.notes.tmp" {
+		t.Errorf("Expected .msync.notes.tmp to be copied: %v", err)
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination directory: %v", err)
+	}
+	for _, entry := range entries {
+		if isTempFile(entry.Name()) {
+			t.Errorf("Unexpected temporary file left in destination: %s", entry.Name())
+		}
+	}
+}
+
+func TestIsTempFile(t *testing.T) {
+	tests := map[string]bool{
+		filepath.Base(tempName("/dir/file.txt")):  true,
+		".msync.file.txt.0123456789abcdef.tmp":    true,
+		".msync.notes.tmp":                        false,
+		".msync..0123456789abcdef.tmp":            false, // No destination name
+		".msync.file.txt.0123456789ABCDEF.tmp":    false,
+		".msync.file.txt.0123456789abcde.tmp":     false,
+		".msync.file.txt.0123456789abcdef.tmp.gz": false,
+		"msync.file.txt.0123456789abcdef.tmp":     false,
+		".msync.file.txt-0123456789abcdef.tmp":    false,
+	}
+	for name, want := range tests {
+		if got := isTempFile(name); got != want {
+			t.Errorf("isTempFile(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
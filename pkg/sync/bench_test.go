@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -33,7 +34,7 @@ func BenchmarkCalculateChecksum(b *testing.B) {
 	}
 }
 
-func BenchmarkBuildFileMap(b *testing.B) {
+func BenchmarkScanTree(b *testing.B) {
 	// Create a directory structure with many files
 	tmpDir := b.TempDir()
 
@@ -50,9 +51,9 @@ func BenchmarkBuildFileMap(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := syncer.buildFileMap(tmpDir, "")
-		if err != nil {
-			b.Fatalf("Failed to build file map: %v", err)
+		entries := make(chan scanEntry, scanBufferSize)
+		go syncer.scanTree(tmpDir, nil, false, nil, nil, entries)
+		for range entries {
 		}
 	}
 }
@@ -86,3 +87,32 @@ func BenchmarkSync(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkSyncChecksum(b *testing.B) {
+	// Identical trees, so the run is all scanning and hashing
+	tmpDir := b.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	content := bytes.Repeat([]byte("checksum benchmark "), 1<<14)
+	for _, dir := range []string{sourceDir, destDir} {
+		for i := 0; i < 64; i++ {
+			subDir := filepath.Join(dir, fmt.Sprintf("dir%d", i%8))
+			if err := os.MkdirAll(subDir, 0755); err != nil {
+				b.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(subDir, fmt.Sprintf("file%d.bin", i)), content, 0644); err != nil {
+				b.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Threads: 4, Method: "checksum"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := syncer.Sync(sourceDir, destDir); err != nil {
+			b.Fatalf("Failed to sync: %v", err)
+		}
+	}
+}
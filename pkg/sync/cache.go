@@ -0,0 +1,228 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// checksumCacheVersion is bumped whenever the cache file format changes
+const checksumCacheVersion = 1
+
+// cacheEntry is a cached checksum together with the file attributes it is
+// valid for. Any change to them invalidates the entry.
+type cacheEntry struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mtime"`
+	Inode      uint64 `json:"inode"`
+	ChangeTime int64  `json:"ctime"`
+	Checksum   string `json:"checksum"`
+}
+
+// checksumCacheFile is the on-disk format of a checksum cache
+type checksumCacheFile struct {
+	Version   int                   `json:"version"`
+	Root      string                `json:"root"`
+	Algorithm string                `json:"algorithm"`
+	Entries   map[string]cacheEntry `json:"entries"`
+}
+
+// checksumCache holds the cached checksums of one tree. Entries looked up or
+// stored during a scan replace the cache file when it is saved, so files
+// that no longer exist are dropped. A limited scan keeps the entries of the
+// paths outside its limit.
+type checksumCache struct {
+	mu        sync.Mutex
+	path      string
+	root      string
+	algorithm string
+	old       map[string]cacheEntry
+	current   map[string]cacheEntry
+	changed   bool
+}
+
+// openChecksumCache loads the checksum cache of the tree at root. It returns
+// nil when caching is disabled. With Rehash the existing entries are
+// ignored, but the cache is still rewritten.
+func (s *Syncer) openChecksumCache(root string) *checksumCache {
+	if s.options.CacheDir == "" || !s.shouldCalculateChecksum() {
+		return nil
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		s.addError(root, fmt.Errorf("Failed to resolve %s for checksum cache: %w", root, err))
+		return nil
+	}
+
+	// One cache file per tree, named after its absolute path
+	sum := sha256.Sum256([]byte(absRoot))
+	cache := &checksumCache{
+		path:      filepath.Join(s.options.CacheDir, fmt.Sprintf("%x.json", sum[:16])),
+		root:      absRoot,
+		algorithm: s.options.ChecksumAlgo,
+		old:       make(map[string]cacheEntry),
+		current:   make(map[string]cacheEntry),
+	}
+
+	if s.options.Rehash {
+		cache.changed = true
+		return cache
+	}
+
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.addError(cache.path, fmt.Errorf("Failed to read checksum cache %s: %w", cache.path, err))
+		}
+		return cache
+	}
+
+	var file checksumCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		// A damaged cache is rebuilt rather than trusted
+		s.logger.Warn("Ignoring damaged checksum cache", "path", cache.path, "error", err)
+		return cache
+	}
+	// Checksums of another algorithm are useless, so such a cache is replaced
+	if file.Version == checksumCacheVersion && file.Root == absRoot && file.Algorithm == cache.algorithm && file.Entries != nil {
+		cache.old = file.Entries
+	}
+
+	return cache
+}
+
+// newCacheEntry returns the cache key attributes of a file
+func newCacheEntry(info os.FileInfo) cacheEntry {
+	_, ino, _, _ := utils.FileID(info)
+	return cacheEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Inode:      ino,
+		ChangeTime: utils.ChangeTime(info).UnixNano(),
+	}
+}
+
+// lookup returns the cached checksum of relPath if its attributes still
+// match entry
+func (c *checksumCache) lookup(relPath string, entry cacheEntry) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.old[relPath]
+	if !ok || cached.Checksum == "" {
+		return "", false
+	}
+	checksum := cached.Checksum
+	cached.Checksum = ""
+	if cached != entry {
+		return "", false
+	}
+
+	entry.Checksum = checksum
+	c.current[relPath] = entry
+	return checksum, true
+}
+
+// store records the checksum of relPath
+func (c *checksumCache) store(relPath string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current[relPath] = entry
+	c.changed = true
+}
+
+// keepUnscanned carries over the loaded entries of the paths a scan limited
+// to limit did not look at, so that they are not dropped as gone
+func (c *checksumCache) keepUnscanned(limit *scanLimit) {
+	if limit == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for relPath, entry := range c.old {
+		if _, ok := c.current[relPath]; !ok && !limit.includes(relPath) {
+			c.current[relPath] = entry
+		}
+	}
+}
+
+// save writes the entries of the current scan to the cache file, if they
+// differ from what was loaded
+func (c *checksumCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.changed && len(c.current) == len(c.old) {
+		return nil
+	}
+
+	data, err := json.Marshal(checksumCacheFile{
+		Version:   checksumCacheVersion,
+		Root:      c.root,
+		Algorithm: c.algorithm,
+		Entries:   c.current,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode checksum cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create checksum cache directory: %w", err)
+	}
+
+	tmp, err := createTempFile(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to create checksum cache %s: %w", c.path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		discardTempFile(tmp)
+		return fmt.Errorf("failed to write checksum cache %s: %w", c.path, err)
+	}
+	return commitTempFile(tmp, c.path)
+}
+
+// fileChecksum returns the checksum of a scanned file, from the cache when
+// its attributes are unchanged
+func (s *Syncer) fileChecksum(cache *checksumCache, relPath, path string, info os.FileInfo) (string, error) {
+	if cache == nil {
+		return s.calculateChecksum(path)
+	}
+
+	// The checksum of a symlink copied as a file is that of its target
+	if info.Mode()&os.ModeSymlink != 0 {
+		targetInfo, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		info = targetInfo
+	}
+
+	entry := newCacheEntry(info)
+	if checksum, ok := cache.lookup(relPath, entry); ok {
+		s.incrementCacheHit()
+		return checksum, nil
+	}
+
+	checksum, err := s.calculateChecksum(path)
+	if err != nil {
+		return "", err
+	}
+
+	// A file modified within the last second could change again without
+	// its mtime moving, so its checksum is not trusted on the next run
+	if time.Since(info.ModTime()) > time.Second {
+		entry.Checksum = checksum
+		cache.store(relPath, entry)
+	}
+
+	return checksum, nil
+}
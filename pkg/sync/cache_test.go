@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChecksumCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+
+	// Files modified within the last second are never cached
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(sourceDir, name)
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to set file times: %v", err)
+		}
+	}
+
+	options := Options{Recursive: true, Method: "checksum", CacheDir: cacheDir}
+	syncer := New(options)
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+	if syncer.stats.CacheHits != 0 {
+		t.Errorf("Expected no cache hits on first sync, got %d", syncer.stats.CacheHits)
+	}
+
+	// The destination did not exist during the first scan, so only the
+	// source has cached checksums yet
+	for run, want := range []int64{2, 4} {
+		syncer = New(options)
+		if err := syncer.Sync(sourceDir, destDir); err != nil {
+			t.Fatalf("Sync %d failed: %v", run+2, err)
+		}
+		if syncer.stats.CacheHits != want {
+			t.Errorf("Sync %d: expected %d cache hits, got %d", run+2, want, syncer.stats.CacheHits)
+		}
+	}
+
+	// Changing content while keeping size and mtime still invalidates the
+	// entry, through the change time
+	path := filepath.Join(sourceDir, "a.txt")
+	if err := os.WriteFile(path, []byte("CONTENT OF a.txt"), 0644); err != nil {
+		t.Fatalf("Failed to modify source file: %v", err)
+	}
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+
+	syncer = New(options)
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync after modification failed: %v", err)
+	}
+	if syncer.stats.FilesCopied != 1 {
+		t.Errorf("Expected modified file to be copied, got %d copies", syncer.stats.FilesCopied)
+	}
+
+	// Rehash ignores the cache entirely
+	options.Rehash = true
+	syncer = New(options)
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Rehash sync failed: %v", err)
+	}
+	if syncer.stats.CacheHits != 0 {
+		t.Errorf("Expected no cache hits with Rehash, got %d", syncer.stats.CacheHits)
+	}
+}
+
+func TestChecksumCacheIgnoresDamagedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	syncer := New(Options{Method: "checksum", CacheDir: cacheDir})
+	cache := syncer.openChecksumCache(tmpDir)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+	if err := os.WriteFile(cache.path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write damaged cache: %v", err)
+	}
+
+	cache = syncer.openChecksumCache(tmpDir)
+	if len(cache.old) != 0 {
+		t.Errorf("Expected damaged cache to be ignored, got %d entries", len(cache.old))
+	}
+	if len(syncer.stats.Errors) != 0 {
+		t.Errorf("Expected no errors for a damaged cache, got %v", syncer.stats.Errors)
+	}
+}
+
+func TestChecksumCacheRecordsAlgorithm(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	path := filepath.Join(sourceDir, "file.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+
+	run := func(algo string) *Syncer {
+		syncer := New(Options{Recursive: true, Method: "checksum", ChecksumAlgo: algo, CacheDir: cacheDir})
+		if err := syncer.Sync(sourceDir, filepath.Join(tmpDir, "dest-"+algo)); err != nil {
+			t.Fatalf("Sync with %s failed: %v", algo, err)
+		}
+		return syncer
+	}
+
+	run("sha256")
+	// Checksums cached by another algorithm are never reused
+	if hits := run("xxh64").stats.CacheHits; hits != 0 {
+		t.Errorf("Expected no cache hits after changing algorithm, got %d", hits)
+	}
+	if hits := run("xxh64").stats.CacheHits; hits != 1 {
+		t.Errorf("Expected 1 cache hit with the same algorithm, got %d", hits)
+	}
+}
+
+func TestChecksumCacheDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	path := filepath.Join(sourceDir, "a.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Method: "checksum", CacheDir: cacheDir, DryRun: true})
+	if err := syncer.Sync(sourceDir, filepath.Join(tmpDir, "dest")); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to write a checksum cache, got %v", err)
+	}
+}
+
+func TestChecksumCacheLimitedSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	names := []string{"a.txt", "b.txt", filepath.Join("dir", "c.txt")}
+	for _, name := range names {
+		path := filepath.Join(sourceDir, name)
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to set file times: %v", err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Method: "checksum", CacheDir: cacheDir})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	// A sync limited to some paths keeps the entries of the others, and
+	// drops those of the files gone from its paths
+	if err := os.Remove(filepath.Join(sourceDir, "dir", "c.txt")); err != nil {
+		t.Fatalf("Failed to remove source file: %v", err)
+	}
+	if err := syncer.syncContext(context.Background(), sourceDir, destDir, []string{"a.txt", "dir"}); err != nil {
+		t.Fatalf("Limited sync failed: %v", err)
+	}
+
+	cache := syncer.openChecksumCache(sourceDir)
+	for _, name := range names[:2] {
+		if _, ok := cache.old[name]; !ok {
+			t.Errorf("Expected the cache entry of %s to survive the limited sync", name)
+		}
+	}
+	if _, ok := cache.old[names[2]]; ok {
+		t.Errorf("Expected the cache entry of the removed %s to be dropped", names[2])
+	}
+}
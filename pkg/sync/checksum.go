@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"hash/crc32"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultChecksumAlgo is the checksum algorithm used when none is set
+const DefaultChecksumAlgo = "sha256"
+
+// castagnoliTable uses the CRC32C polynomial, which most CPUs compute in
+// hardware
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumAlgorithms maps the names accepted in Options.ChecksumAlgo to
+// their hash constructors
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+	"blake2b": newBLAKE2b512,
+	"xxh64":   func() hash.Hash { return xxhash.New() },
+	"xxh3":    func() hash.Hash { return xxh3.New() },
+	"crc32c":  func() hash.Hash { return crc32.New(castagnoliTable) },
+}
+
+// newBLAKE2b512 returns an unkeyed BLAKE2b-512 hash
+func newBLAKE2b512() hash.Hash {
+	// Only a key longer than 64 bytes is an error
+	h, _ := blake2b.New512(nil)
+	return h
+}
+
+// ChecksumAlgorithms returns the names of the supported checksum algorithms
+func ChecksumAlgorithms() []string {
+	names := make([]string, 0, len(checksumAlgorithms))
+	for name := range checksumAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidChecksumAlgo reports whether name is a supported checksum algorithm
+func ValidChecksumAlgo(name string) bool {
+	_, ok := checksumAlgorithms[name]
+	return ok
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncWithChecksumAlgorithms(t *testing.T) {
+	for _, algo := range ChecksumAlgorithms() {
+		t.Run(algo, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			sourceDir := filepath.Join(tmpDir, "source")
+			destDir := filepath.Join(tmpDir, "dest")
+
+			for _, dir := range []string{sourceDir, destDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+			}
+
+			// Same size and mtime, so only the checksum tells them apart
+			mtime := time.Now().Add(-time.Hour)
+			files := map[string]string{
+				filepath.Join(sourceDir, "same.txt"):    "identical",
+				filepath.Join(destDir, "same.txt"):      "identical",
+				filepath.Join(sourceDir, "changed.txt"): "new content",
+				filepath.Join(destDir, "changed.txt"):   "old content",
+			}
+			for path, content := range files {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to create file: %v", err)
+				}
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatalf("Failed to set file times: %v", err)
+				}
+			}
+
+			syncer := New(Options{Recursive: true, Method: "checksum", ChecksumAlgo: algo})
+			if err := syncer.Sync(sourceDir, destDir); err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+
+			if syncer.stats.FilesCopied != 1 {
+				t.Errorf("Expected 1 file copied, got %d", syncer.stats.FilesCopied)
+			}
+			content, err := os.ReadFile(filepath.Join(destDir, "changed.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read destination file: %v", err)
+			}
+			if string(content) != "new content" {
+				t.Errorf("Expected changed file to be copied, got %q", content)
+			}
+		})
+	}
+}
+
+func TestSyncRejectsUnknownChecksumAlgo(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	syncer := New(Options{Method: "checksum", ChecksumAlgo: "md4"})
+	if err := syncer.Sync(tmpDir, filepath.Join(tmpDir, "dest")); err == nil {
+		t.Error("Expected an error for an unknown checksum algorithm")
+	}
+}
+
+func TestCompareByChecksumIgnoresOtherAlgorithms(t *testing.T) {
+	syncer := New(Options{Method: "checksum"})
+	mtime := time.Now()
+
+	sourceFile := FileInfo{Path: "a", Size: 4, ModTime: mtime, Checksum: "1234", ChecksumAlgo: "xxh64"}
+	destFile := FileInfo{Path: "a", Size: 4, ModTime: mtime, Checksum: "5678", ChecksumAlgo: "crc32c"}
+
+	// Different checksums of different algorithms are not a difference
+	if syncer.compareByChecksum(sourceFile, destFile) {
+		t.Error("Checksums of different algorithms should not be compared")
+	}
+
+	destFile.ChecksumAlgo = "xxh64"
+	if !syncer.compareByChecksum(sourceFile, destFile) {
+		t.Error("Differing checksums of the same algorithm should be a difference")
+	}
+}
+
+func TestChecksumAlgorithmVectors(t *testing.T) {
+	tests := []struct {
+		algo  string
+		input string
+		want  string
+	}{
+		{"sha256", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"blake2b", "", "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{"blake2b", "abc", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{"xxh64", "", "ef46db3751d8e999"},
+		{"xxh64", "abc", "44bc2cf5ad770999"},
+		{"xxh3", "", "2d06800538d394c2"},
+		{"xxh3", "abc", "78af5f94892f3950"},
+		{"crc32c", "123456789", "e3069283"},
+	}
+
+	for _, test := range tests {
+		h := checksumAlgorithms[test.algo]()
+		h.Write([]byte(test.input))
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("%s(%q) = %s, want %s", test.algo, test.input, got, test.want)
+		}
+	}
+}
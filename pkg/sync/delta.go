@@ -0,0 +1,303 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+const (
+	minDeltaBlockSize = 2 * 1024   // Smallest block size used for signatures
+	maxDeltaBlockSize = 128 * 1024 // Largest block size used for signatures
+)
+
+// rollingChecksum is the rsync weak checksum, which can be updated in O(1)
+// as the window slides one byte forward over the data
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+// newRollingChecksum computes the checksum of a full window
+func newRollingChecksum(window []byte) rollingChecksum {
+	var r rollingChecksum
+	r.n = uint32(len(window))
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += (r.n - uint32(i)) * uint32(c)
+	}
+	return r
+}
+
+// roll slides the window by one byte, dropping out and appending in
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a = r.a - uint32(out) + uint32(in)
+	r.b = r.b - r.n*uint32(out) + r.a
+}
+
+// rollOut drops the first byte of the window without appending a new one
+func (r *rollingChecksum) rollOut(out byte) {
+	r.a -= uint32(out)
+	r.b -= r.n * uint32(out)
+	r.n--
+}
+
+// sum returns the 32-bit weak checksum of the current window
+func (r *rollingChecksum) sum() uint32 {
+	return (r.a & 0xffff) | (r.b << 16)
+}
+
+// blockSignature describes a single block of the basis file
+type blockSignature struct {
+	index  int
+	length int
+	strong [sha256.Size]byte
+}
+
+// signature holds the block signatures of a basis file indexed by weak checksum
+type signature struct {
+	blockSize int
+	blocks    map[uint32][]blockSignature
+}
+
+// deltaBlockSize picks a block size for a basis file of the given size,
+// following rsync's square root heuristic
+func deltaBlockSize(size int64) int {
+	blockSize := int(math.Sqrt(float64(size)))
+	blockSize = (blockSize + 1023) &^ 1023
+	if blockSize < minDeltaBlockSize {
+		return minDeltaBlockSize
+	}
+	if blockSize > maxDeltaBlockSize {
+		return maxDeltaBlockSize
+	}
+	return blockSize
+}
+
+// computeSignature reads the basis file and builds its block signature
+func computeSignature(basis io.Reader, blockSize int) (*signature, error) {
+	sig := &signature{
+		blockSize: blockSize,
+		blocks:    make(map[uint32][]blockSignature),
+	}
+
+	block := make([]byte, blockSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(basis, block)
+		if n > 0 {
+			weak := newRollingChecksum(block[:n])
+			sig.blocks[weak.sum()] = append(sig.blocks[weak.sum()], blockSignature{
+				index:  index,
+				length: n,
+				strong: sha256.Sum256(block[:n]),
+			})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// match looks up a window of source data in the signature
+func (sig *signature) match(weak uint32, window []byte) (blockSignature, bool) {
+	candidates, ok := sig.blocks[weak]
+	if !ok {
+		return blockSignature{}, false
+	}
+
+	var strong [sha256.Size]byte
+	computed := false
+	for _, candidate := range candidates {
+		if candidate.length != len(window) {
+			continue
+		}
+		if !computed {
+			strong = sha256.Sum256(window)
+			computed = true
+		}
+		if bytes.Equal(candidate.strong[:], strong[:]) {
+			return candidate, true
+		}
+	}
+	return blockSignature{}, false
+}
+
+// deltaResult reports how much of a file was sent literally vs. reused
+type deltaResult struct {
+	literal int64
+	matched int64
+}
+
+// applyDelta reconstructs the source into out, reusing blocks of basis that
+// match the signature and writing all other data as literals
+func applyDelta(source io.Reader, basis io.ReaderAt, sig *signature, out io.Writer) (deltaResult, error) {
+	var result deltaResult
+	blockSize := sig.blockSize
+
+	buf := make([]byte, 0, blockSize*8)
+	eof := false
+	fill := func() error {
+		for !eof && len(buf) < cap(buf) {
+			n, err := source.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	writeLiteral := func(data []byte) error {
+		if len(data) == 0 {
+			return nil
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		result.literal += int64(len(data))
+		return nil
+	}
+
+	if err := fill(); err != nil {
+		return result, err
+	}
+
+	var weak rollingChecksum
+	haveWeak := false
+	literalStart, pos := 0, 0
+
+	for {
+		// Make sure a full window is buffered, compacting the buffer when needed
+		if pos+blockSize > len(buf) && !eof {
+			if err := writeLiteral(buf[literalStart:pos]); err != nil {
+				return result, err
+			}
+			remaining := copy(buf, buf[pos:])
+			buf = buf[:remaining]
+			literalStart, pos = 0, 0
+			if err := fill(); err != nil {
+				return result, err
+			}
+		}
+
+		windowLen := len(buf) - pos
+		if windowLen > blockSize {
+			windowLen = blockSize
+		}
+		if windowLen == 0 {
+			break
+		}
+		window := buf[pos : pos+windowLen]
+
+		if !haveWeak {
+			weak = newRollingChecksum(window)
+			haveWeak = true
+		}
+
+		if block, ok := sig.match(weak.sum(), window); ok {
+			if err := writeLiteral(buf[literalStart:pos]); err != nil {
+				return result, err
+			}
+			offset := int64(block.index) * int64(blockSize)
+			if _, err := io.Copy(out, io.NewSectionReader(basis, offset, int64(block.length))); err != nil {
+				return result, fmt.Errorf("failed to copy matched block: %w", err)
+			}
+			result.matched += int64(block.length)
+			pos += windowLen
+			literalStart = pos
+			haveWeak = false
+			continue
+		}
+
+		// No match, slide the window forward by one byte
+		switch {
+		case pos+blockSize < len(buf):
+			weak.roll(buf[pos], buf[pos+blockSize])
+		case eof:
+			weak.rollOut(buf[pos])
+		default:
+			// The next byte is not buffered yet; recompute after refilling
+			haveWeak = false
+		}
+		pos++
+	}
+
+	if err := writeLiteral(buf[literalStart:]); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// deltaCopyFile updates an existing destination file from src, rewriting it
+// from the blocks it already contains plus the literal data that changed
+func (s *Syncer) deltaCopyFile(src, dst string, dstInfo os.FileInfo, fileInfo FileInfo, tee io.Writer) error {
+	blockSize := s.options.DeltaBlockSize
+	if blockSize <= 0 {
+		blockSize = deltaBlockSize(dstInfo.Size())
+	}
+
+	s.logger.Debug("Computing delta against existing destination", "path", dst, "block_size", blockSize)
+
+	basis, err := os.Open(dst)
+	if err != nil {
+		return fmt.Errorf("failed to open destination file %s: %w", dst, err)
+	}
+	defer basis.Close()
+
+	sig, err := computeSignature(basis, blockSize)
+	if err != nil {
+		return fmt.Errorf("failed to compute signature for %s: %w", dst, err)
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %w", src, err)
+	}
+	defer source.Close()
+
+	tmp, err := createTempFile(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", dst, err)
+	}
+
+	if err := s.setTempMetadata(tmp, dst, fileInfo); err != nil {
+		discardTempFile(tmp)
+		return err
+	}
+
+	var out io.Writer = tmp
+	var sparse *utils.SparseWriter
+	if s.options.Sparse {
+		sparse = utils.NewSparseWriter(tmp)
+		out = sparse
+	}
+
+	result, err := applyDelta(teeReader(s.throttleReader(source), tee), basis, sig, out)
+	if err == nil && sparse != nil {
+		err = sparse.Close()
+	}
+	if err != nil {
+		discardTempFile(tmp)
+		return fmt.Errorf("failed to apply delta: %w", err)
+	}
+
+	if err := commitTempFile(tmp, dst); err != nil {
+		return err
+	}
+
+	s.incrementDelta(result.literal, result.matched)
+
+	s.logger.Debug("Delta applied", "path", dst, "literal", result.literal, "matched", result.matched)
+
+	return nil
+}
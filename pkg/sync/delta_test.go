@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRollingChecksum(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	window := 8
+
+	rolling := newRollingChecksum(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		rolling.roll(data[i-1], data[i+window-1])
+		fresh := newRollingChecksum(data[i : i+window])
+		if rolling.sum() != fresh.sum() {
+			t.Fatalf("Rolled checksum mismatch at offset %d: got %08x, want %08x", i, rolling.sum(), fresh.sum())
+		}
+	}
+
+	// Shrinking the window at the tail must match a fresh checksum too
+	start := len(data) - window
+	rolling = newRollingChecksum(data[start:])
+	for i := start + 1; i < len(data); i++ {
+		rolling.rollOut(data[i-1])
+		fresh := newRollingChecksum(data[i:])
+		if rolling.sum() != fresh.sum() {
+			t.Fatalf("Shrunk checksum mismatch at offset %d: got %08x, want %08x", i, rolling.sum(), fresh.sum())
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	basis := make([]byte, 64*1024+123)
+	rng.Read(basis)
+
+	// Insert, modify and delete data at different offsets
+	source := append([]byte{}, basis[:10000]...)
+	source = append(source, []byte("inserted bytes")...)
+	source = append(source, basis[10000:30000]...)
+	source = append(source, bytes.Repeat([]byte{0xff}, 500)...)
+	source = append(source, basis[30500:50000]...)
+	source = append(source, basis[52000:]...)
+
+	blockSize := 2048
+	sig, err := computeSignature(bytes.NewReader(basis), blockSize)
+	if err != nil {
+		t.Fatalf("Failed to compute signature: %v", err)
+	}
+
+	var out bytes.Buffer
+	result, err := applyDelta(bytes.NewReader(source), bytes.NewReader(basis), sig, &out)
+	if err != nil {
+		t.Fatalf("Failed to apply delta: %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), source) {
+		t.Fatal("Reconstructed data does not match source")
+	}
+
+	if result.literal+result.matched != int64(len(source)) {
+		t.Errorf("Expected literal+matched to be %d, got %d", len(source), result.literal+result.matched)
+	}
+
+	if result.matched < int64(len(source))*3/4 {
+		t.Errorf("Expected most data to be matched, got %d of %d bytes", result.matched, len(source))
+	}
+}
+
+func TestSyncWithDelta(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	content := make([]byte, 256*1024)
+	rng.Read(content)
+
+	destFile := filepath.Join(destDir, "image.bin")
+	if err := os.WriteFile(destFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create destination file: %v", err)
+	}
+	older := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(destFile, older, older); err != nil {
+		t.Fatalf("Failed to set destination times: %v", err)
+	}
+
+	// Change a few bytes in the middle of the source copy
+	copy(content[100000:], []byte("changed"))
+	if err := os.WriteFile(filepath.Join(sourceDir, "image.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Delta: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatalf("Failed to read destination file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Destination content does not match source after delta sync")
+	}
+
+	if syncer.stats.MatchedBytes == 0 {
+		t.Error("Expected matched bytes to be reported")
+	}
+	if syncer.stats.LiteralBytes >= int64(len(content))/2 {
+		t.Errorf("Expected a small literal transfer, got %d bytes", syncer.stats.LiteralBytes)
+	}
+}
@@ -0,0 +1,103 @@
+package sync
+
+import "time"
+
+// EventType identifies what an Event reports
+type EventType string
+
+// Types of Event
+const (
+	EventPhase        EventType = "phase"         // The sync entered Phase
+	EventFileScanned  EventType = "file_scanned"  // Path was found in the tree at Root
+	EventDecision     EventType = "decision"      // Action was chosen for Path, for Reason
+	EventCopyStarted  EventType = "copy_started"  // Copying Path, Size bytes, has started
+	EventCopyProgress EventType = "copy_progress" // Done bytes of Path have been copied
+	EventCopyFinished EventType = "copy_finished" // Copying Path has ended, failed if Err is set
+	EventDelete       EventType = "delete"        // Path was deleted from the destination
+	EventError        EventType = "error"         // Err occurred for Path
+)
+
+// Phase is a stage of a sync
+type Phase string
+
+// Phases of a sync, in order. A TAR sync extracts and archives around the
+// phases of the directory sync.
+const (
+	PhaseExtract  Phase = "extract"  // Extracting a source or destination TAR archive
+	PhaseScan     Phase = "scan"     // Scanning both trees and syncing what differs
+	PhaseTransfer Phase = "transfer" // Scan done, finishing the queued work
+	PhaseFinish   Phase = "finish"   // Saving checksum caches
+	PhaseArchive  Phase = "archive"  // Creating the destination TAR archive
+	PhaseDone     Phase = "done"     // The sync has ended
+)
+
+// copyProgressInterval is the number of bytes copied between two
+// EventCopyProgress events of a file
+const copyProgressInterval = 1 << 20
+
+// Event is something a sync did or found
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Phase  Phase  // For EventPhase
+	Root   string // For EventFileScanned and EventDelete, the tree Path is in
+	Path   string // Relative to the trees, or a full path for EventError
+	Action string // For EventDecision, one of the Action constants
+	Reason string // For EventDecision, why the action was chosen
+	Size   int64  // Size of the file
+	Done   int64  // For copies, source bytes copied so far
+	Err    error  // For EventError and failed copies
+}
+
+// EventHandler receives the events of a sync. HandleEvent is called from
+// the scanning and copying goroutines concurrently, so it must be safe for
+// concurrent use, and it holds up the sync while it runs.
+type EventHandler interface {
+	HandleEvent(Event)
+}
+
+// EventHandlerFunc lets an ordinary function be used as an EventHandler
+type EventHandlerFunc func(Event)
+
+// HandleEvent calls f(event)
+func (f EventHandlerFunc) HandleEvent(event Event) {
+	f(event)
+}
+
+// emit sends an event to the handler in Options.Events, if any
+func (s *Syncer) emit(event Event) {
+	if s.options.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	s.options.Events.HandleEvent(event)
+}
+
+// emitPhase reports that the sync entered phase
+func (s *Syncer) emitPhase(phase Phase) {
+	s.emit(Event{Type: EventPhase, Phase: phase})
+}
+
+// emitDecision reports the action chosen for the entry at relPath
+func (s *Syncer) emitDecision(relPath, action string, size int64, reason string) {
+	s.emit(Event{Type: EventDecision, Path: relPath, Action: action, Size: size, Reason: reason})
+}
+
+// copyEvents emits EventCopyProgress for a copy as its source data is
+// written to it. A copy is written to from a single goroutine.
+type copyEvents struct {
+	s        *Syncer
+	path     string
+	size     int64
+	done     int64
+	reported int64
+}
+
+func (c *copyEvents) Write(p []byte) (int, error) {
+	c.done += int64(len(p))
+	if c.done-c.reported >= copyProgressInterval {
+		c.reported = c.done
+		c.s.emit(Event{Type: EventCopyProgress, Path: c.path, Size: c.size, Done: c.done})
+	}
+	return len(p), nil
+}
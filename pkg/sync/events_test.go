@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSyncEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	large := bytes.Repeat([]byte("large "), 1<<19)
+	if err := os.WriteFile(filepath.Join(sourceDir, "sub", "large.bin"), large, 0644); err != nil {
+		t.Fatalf("Failed to create large file: %v", err)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(destDir, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatalf("Failed to create extra file: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []Event
+	handler := EventHandlerFunc(func(event Event) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+
+	syncer := New(Options{Recursive: true, Delete: true, Events: handler})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	var phases []Phase
+	var progress int
+	byType := make(map[EventType]map[string]Event)
+	for _, event := range events {
+		if event.Time.IsZero() {
+			t.Errorf("Event %+v has no time", event)
+		}
+		switch event.Type {
+		case EventPhase:
+			phases = append(phases, event.Phase)
+		case EventCopyProgress:
+			progress++
+		default:
+			if byType[event.Type] == nil {
+				byType[event.Type] = make(map[string]Event)
+			}
+			byType[event.Type][event.Path] = event
+		}
+	}
+
+	wantPhases := []Phase{PhaseScan, PhaseTransfer, PhaseFinish, PhaseDone}
+	if len(phases) != len(wantPhases) {
+		t.Fatalf("Expected phases %v, got %v", wantPhases, phases)
+	}
+	for i := range wantPhases {
+		if phases[i] != wantPhases[i] {
+			t.Errorf("Expected phases %v, got %v", wantPhases, phases)
+			break
+		}
+	}
+
+	largePath := filepath.Join("sub", "large.bin")
+	if event, ok := byType[EventFileScanned][largePath]; !ok || event.Root != sourceDir {
+		t.Errorf("Expected %s to be scanned in %s, got %+v", largePath, sourceDir, event)
+	}
+	if event, ok := byType[EventFileScanned]["extra.txt"]; !ok || event.Root != destDir {
+		t.Errorf("Expected extra.txt to be scanned in %s, got %+v", destDir, event)
+	}
+	if event := byType[EventDecision][largePath]; event.Action != ActionCopy || event.Reason != "new" {
+		t.Errorf("Expected a decision to copy the new %s, got %+v", largePath, event)
+	}
+	if event := byType[EventDecision]["sub"]; event.Action != ActionMkdir {
+		t.Errorf("Expected a decision to create sub, got %+v", event)
+	}
+	if _, ok := byType[EventCopyStarted][largePath]; !ok {
+		t.Errorf("Expected the copy of %s to start", largePath)
+	}
+	if event := byType[EventCopyFinished][largePath]; event.Done != int64(len(large)) || event.Err != nil {
+		t.Errorf("Expected the copy of %s to finish with %d bytes, got %+v", largePath, len(large), event)
+	}
+	if progress < 2 {
+		t.Errorf("Expected progress events for a %d byte file, got %d", len(large), progress)
+	}
+	if event, ok := byType[EventDelete]["extra.txt"]; !ok || event.Root != destDir {
+		t.Errorf("Expected extra.txt to be deleted from %s, got %+v", destDir, event)
+	}
+	if len(byType[EventError]) != 0 {
+		t.Errorf("Expected no errors, got %v", byType[EventError])
+	}
+}
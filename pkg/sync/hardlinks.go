@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// inodeKey identifies a file on disk independent of its names
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// setFileID records the device and inode of a regular file that has more
+// than one name, so hard links to it can be grouped
+func (s *Syncer) setFileID(fileInfo *FileInfo, info os.FileInfo) {
+	if !s.options.HardLinks || !info.Mode().IsRegular() {
+		return
+	}
+	if dev, ino, nlink, ok := utils.FileID(info); ok && nlink > 1 {
+		fileInfo.Device = dev
+		fileInfo.Inode = ino
+	}
+}
+
+// linkLeader is the first name of a group of hard-linked source files seen
+// by the scan. It is copied as usual, and every later name of the group is
+// linked to it once done is closed.
+type linkLeader struct {
+	path   string
+	dest   *FileInfo // Destination entry at path, if any
+	synced bool      // Whether the leader was copied, set before done is closed
+	done   chan struct{}
+}
+
+// hardLinkLeader returns the leader of the hard link group of fileInfo, and
+// whether fileInfo is that leader. Only files with several names belong to
+// a group; for others it returns nil.
+func (p *pipeline) hardLinkLeader(fileInfo FileInfo, dest *FileInfo) (*linkLeader, bool) {
+	if fileInfo.Inode == 0 {
+		return nil, false
+	}
+
+	key := inodeKey{fileInfo.Device, fileInfo.Inode}
+	if leader, ok := p.leaders[key]; ok {
+		return leader, false
+	}
+	leader := &linkLeader{path: fileInfo.Path, dest: dest, done: make(chan struct{})}
+	p.leaders[key] = leader
+	return leader, true
+}
+
+// linkHardLink recreates an extra name of a hard-linked source file once the
+// leader of its group has been copied
+func (s *Syncer) linkHardLink(dest string, fileInfo FileInfo, destFile *FileInfo, leader *linkLeader) {
+	<-leader.done
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	destPath := filepath.Join(dest, fileInfo.Path)
+	targetPath := filepath.Join(dest, leader.path)
+	if !s.hardLinkNeeded(destFile, leader, destPath, targetPath) {
+		s.emitDecision(fileInfo.Path, ActionSkip, 0, "unchanged")
+		s.recordAction(fileInfo.Path, ActionSkip, 0, "unchanged")
+		return
+	}
+	s.emitDecision(fileInfo.Path, ActionHardlink, 0, "linked to "+leader.path)
+
+	if err := s.syncHardLink(destPath, targetPath); err != nil {
+		s.addError(destPath, err)
+		return
+	}
+	if s.options.Itemize {
+		s.printItem(s.itemize(itemHardlink, fileInfo, destFile), fileInfo.Path, " => "+leader.path)
+	}
+	s.recordAction(fileInfo.Path, ActionHardlink, 0, "linked to "+leader.path)
+}
+
+// hardLinkNeeded reports whether destPath has to be (re)linked to targetPath
+func (s *Syncer) hardLinkNeeded(destFile *FileInfo, leader *linkLeader, destPath, targetPath string) bool {
+	if s.options.DryRun {
+		// Nothing was copied, so judge from the destination scan: the link
+		// is needed if its target is about to be replaced or if the two
+		// names are not the same file yet
+		if leader.synced {
+			return true
+		}
+		return destFile == nil || leader.dest == nil || destFile.Inode == 0 ||
+			destFile.Inode != leader.dest.Inode || destFile.Device != leader.dest.Device
+	}
+
+	destInfo, err := os.Lstat(destPath)
+	if err != nil {
+		return true
+	}
+	targetInfo, err := os.Lstat(targetPath)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(destInfo, targetInfo)
+}
+
+// syncHardLink creates destPath as a hard link to targetPath
+func (s *Syncer) syncHardLink(destPath, targetPath string) error {
+	s.logAction("Hard linking", "Would hard link", "path", destPath, "target", targetPath)
+
+	if s.options.DryRun {
+		s.incrementFileToCopy(0)
+		return nil
+	}
+
+	if info, err := os.Lstat(destPath); err == nil && info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s with a hard link", destPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	// Create the link under a temporary name and rename it into place, so an
+	// existing file is replaced atomically
+	for i := 0; ; i++ {
+		tmpPath := tempName(destPath)
+		err := os.Link(targetPath, tmpPath)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create hard link %s: %w", destPath, err)
+		}
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to create hard link %s: %w", destPath, err)
+		}
+		break
+	}
+
+	s.incrementCopied(0)
+	return nil
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncPreservesHardLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	original := filepath.Join(sourceDir, "a.txt")
+	if err := os.WriteFile(original, []byte("shared content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	for _, name := range []string{"b.txt", "sub/c.txt"} {
+		if err := os.Link(original, filepath.Join(sourceDir, name)); err != nil {
+			t.Fatalf("Failed to create hard link: %v", err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, HardLinks: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	first, err := os.Stat(filepath.Join(destDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination file: %v", err)
+	}
+	for _, name := range []string{"b.txt", "sub/c.txt"} {
+		info, err := os.Stat(filepath.Join(destDir, name))
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", name, err)
+		}
+		if !os.SameFile(first, info) {
+			t.Errorf("Expected %s to be a hard link to a.txt", name)
+		}
+	}
+
+	// Data is only transferred once
+	if syncer.stats.BytesCopied != int64(len("shared content")) {
+		t.Errorf("Expected %d bytes copied, got %d", len("shared content"), syncer.stats.BytesCopied)
+	}
+
+	// A second run finds the links in place
+	syncer = New(Options{Recursive: true, HardLinks: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if syncer.stats.FilesCopied != 0 {
+		t.Errorf("Expected nothing to be copied on second sync, got %d", syncer.stats.FilesCopied)
+	}
+}
+
+func TestSyncRelinksBrokenHardLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.Link(filepath.Join(sourceDir, "a.txt"), filepath.Join(sourceDir, "b.txt")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+
+	// The destination holds an independent copy of the second name
+	if err := New(Options{Recursive: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	preview := New(Options{Recursive: true, HardLinks: true, DryRun: true})
+	if err := preview.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if preview.stats.FilesToCopy != 1 {
+		t.Errorf("Expected 1 planned link, got %d", preview.stats.FilesToCopy)
+	}
+
+	if err := New(Options{Recursive: true, HardLinks: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	a, err := os.Stat(filepath.Join(destDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat a.txt: %v", err)
+	}
+	b, err := os.Stat(filepath.Join(destDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat b.txt: %v", err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("Expected b.txt to be relinked to a.txt")
+	}
+}
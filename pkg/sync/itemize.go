@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// Update types in the first column of an itemized change
+const (
+	itemTransfer = '>' // File content is transferred
+	itemCreate   = 'c' // Directory or symlink is created or changed locally
+	itemHardlink = 'h' // Name is hard linked to another file
+	itemMetadata = '.' // Only attributes are changed
+)
+
+// itemize describes the change made to an entry in the format of rsync
+// --itemize-changes: YXcstpoguax, where Y is the update type, X the file
+// type and every following letter an attribute that differs: checksum,
+// size, modification time, permissions, owner, group, (unused), ACLs and
+// extended attributes. New entries show + for every attribute.
+func (s *Syncer) itemize(update byte, sourceFile FileInfo, destFile *FileInfo) string {
+	item := []byte{update, 'f', '.', '.', '.', '.', '.', '.', '.', '.', '.'}
+	switch {
+	case sourceFile.IsDir:
+		item[1] = 'd'
+	case sourceFile.IsSymlink:
+		item[1] = 'L'
+	}
+
+	if destFile == nil || destFile.IsDir != sourceFile.IsDir || destFile.IsSymlink != sourceFile.IsSymlink {
+		for i := 2; i < len(item); i++ {
+			item[i] = '+'
+		}
+		return string(item)
+	}
+
+	if s.options.Method == "checksum" && sourceFile.Checksum != "" && sourceFile.ChecksumAlgo == destFile.ChecksumAlgo &&
+		sourceFile.Checksum != destFile.Checksum {
+		item[2] = 'c'
+	}
+	if sourceFile.IsSymlink && sourceFile.LinkTarget != destFile.LinkTarget {
+		item[2] = 'c'
+	}
+	if sourceFile.Size != destFile.Size {
+		item[3] = 's'
+	}
+	if !sourceFile.IsDir && !sourceFile.ModTime.Equal(destFile.ModTime) {
+		item[4] = 't'
+	}
+	if s.options.Perms && !sourceFile.IsSymlink && permBits(sourceFile.Mode) != permBits(destFile.Mode) {
+		item[5] = 'p'
+	}
+	if s.preserveOwner() && sourceFile.Uid >= 0 && sourceFile.Uid != destFile.Uid {
+		item[6] = 'o'
+	}
+	if s.options.Group && sourceFile.Gid >= 0 && sourceFile.Gid != destFile.Gid {
+		item[7] = 'g'
+	}
+	if s.options.ACLs && xattrsDiffer(utils.SelectXattrs(sourceFile.Xattrs, false, true), utils.SelectXattrs(destFile.Xattrs, false, true)) {
+		item[9] = 'a'
+	}
+	if s.options.Xattrs && xattrsDiffer(utils.SelectXattrs(sourceFile.Xattrs, true, false), utils.SelectXattrs(destFile.Xattrs, true, false)) {
+		item[10] = 'x'
+	}
+	return string(item)
+}
+
+// printItem writes an itemized change of relPath to Output if Itemize is set
+func (s *Syncer) printItem(item, relPath, suffix string) {
+	if s.options.Itemize {
+		s.mu.Lock()
+		fmt.Fprintf(s.options.Output, "%-11s %s%s\n", item, filepath.ToSlash(relPath), suffix)
+		s.mu.Unlock()
+	}
+}
+
+// printSyncItem writes the itemized change of an entry that is copied,
+// created or has its attributes updated
+func (s *Syncer) printSyncItem(update byte, sourceFile FileInfo, destFile *FileInfo) {
+	if !s.options.Itemize {
+		return
+	}
+
+	suffix := ""
+	if sourceFile.IsDir {
+		suffix = "/"
+	}
+	switch {
+	case update == itemMetadata:
+	case sourceFile.IsDir:
+		update = itemCreate
+	case sourceFile.IsSymlink:
+		update = itemCreate
+		suffix = " -> " + sourceFile.LinkTarget
+	}
+	s.printItem(s.itemize(update, sourceFile, destFile), sourceFile.Path, suffix)
+}
@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestItemize(t *testing.T) {
+	now := time.Now()
+	source := FileInfo{Path: "file.txt", Size: 100, ModTime: now, Mode: 0644, Checksum: "aa", ChecksumAlgo: "sha256"}
+
+	sameContent := source
+	resized := source
+	resized.Size = 50
+	retimed := source
+	retimed.ModTime = now.Add(-time.Hour)
+	rehashed := source
+	rehashed.Checksum = "bb"
+	chmodded := source
+	chmodded.Mode = 0600
+	dir := FileInfo{Path: "dir", IsDir: true, Mode: os.ModeDir | 0755}
+
+	tests := []struct {
+		name    string
+		options Options
+		update  byte
+		source  FileInfo
+		dest    *FileInfo
+		want    string
+	}{
+		{"new file", Options{}, itemTransfer, source, nil, ">f+++++++++"},
+		{"size", Options{}, itemTransfer, source, &resized, ">f.s......."},
+		{"mtime", Options{}, itemTransfer, source, &retimed, ">f..t......"},
+		{"checksum", Options{Method: "checksum"}, itemTransfer, source, &rehashed, ">fc........"},
+		{"perms", Options{Perms: true}, itemMetadata, source, &chmodded, ".f...p....."},
+		{"perms not preserved", Options{}, itemMetadata, source, &chmodded, ".f........."},
+		{"unchanged", Options{}, itemMetadata, source, &sameContent, ".f........."},
+		{"new directory", Options{}, itemCreate, dir, nil, "cd+++++++++"},
+		{"file replaces directory", Options{}, itemTransfer, source, &dir, ">f+++++++++"},
+	}
+
+	for _, tt := range tests {
+		syncer := New(tt.options)
+		if got := syncer.itemize(tt.update, tt.source, tt.dest); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// symlinkInfo builds the FileInfo of a symlink that is preserved as a link.
+// It returns false if the link should be skipped.
+func (s *Syncer) symlinkInfo(root, path, relPath string, info os.FileInfo) (FileInfo, bool) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		s.addError(path, fmt.Errorf("Failed to read symlink %s: %w", path, err))
+		return FileInfo{}, false
+	}
+
+	if s.options.SkipBrokenLinks {
+		if _, err := os.Stat(path); err != nil {
+			s.logger.Info("Skipping broken symlink", "path", path)
+			s.emitDecision(relPath, ActionSkip, 0, "broken symlink")
+			s.recordAction(relPath, ActionSkip, 0, "broken symlink")
+			return FileInfo{}, false
+		}
+	}
+
+	if s.options.RewriteLinks && filepath.IsAbs(target) {
+		target = rewriteAbsoluteLink(root, relPath, target)
+	}
+
+	if s.options.SafeLinks && utils.IsUnsafeLink(relPath, target) {
+		s.logger.Info("Skipping unsafe symlink", "path", path, "target", target)
+		s.emitDecision(relPath, ActionSkip, 0, "unsafe symlink")
+		s.recordAction(relPath, ActionSkip, 0, "unsafe symlink")
+		return FileInfo{}, false
+	}
+
+	uid, gid, _ := fileOwner(info)
+	return FileInfo{
+		Path:       relPath,
+		Size:       int64(len(target)),
+		ModTime:    info.ModTime(),
+		IsSymlink:  true,
+		LinkTarget: target,
+		Mode:       info.Mode(),
+		Uid:        uid,
+		Gid:        gid,
+	}, true
+}
+
+// rewriteAbsoluteLink turns an absolute link target that points inside root
+// into a target relative to the link, so it resolves to the same file within
+// whatever tree the link is copied to. Targets outside root are returned
+// unchanged.
+func rewriteAbsoluteLink(root, relPath, target string) string {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return target
+	}
+
+	inRoot, err := filepath.Rel(absRoot, filepath.Clean(target))
+	if err != nil || inRoot == ".." || strings.HasPrefix(inRoot, ".."+string(filepath.Separator)) {
+		return target
+	}
+
+	relTarget, err := filepath.Rel(filepath.Dir(filepath.Join(absRoot, relPath)), filepath.Join(absRoot, inRoot))
+	if err != nil {
+		return target
+	}
+	return relTarget
+}
+
+// followLinkedDir reports whether the directory a symlink points to can be
+// walked as if it were a regular directory at the link's location
+func (s *Syncer) followLinkedDir(path string) bool {
+	// Refuse to follow links to one of the link's own ancestors
+	realTarget, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.addError(path, fmt.Errorf("Failed to resolve symlink %s: %w", path, err))
+		return false
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		s.addError(path, fmt.Errorf("Failed to resolve symlink %s: %w", path, err))
+		return false
+	}
+	if realParent == realTarget || strings.HasPrefix(realParent, realTarget+string(filepath.Separator)) {
+		s.addError(path, fmt.Errorf("Skipping symlink loop: %s -> %s", path, realTarget))
+		return false
+	}
+	return true
+}
+
+// syncSymlink recreates a symlink in the destination
+func (s *Syncer) syncSymlink(destPath string, fileInfo FileInfo) error {
+	s.logAction("Linking", "Would link", "path", destPath, "target", fileInfo.LinkTarget)
+
+	if s.options.DryRun {
+		s.incrementFileToCopy(0)
+		return nil
+	}
+
+	if info, err := os.Lstat(destPath); err == nil && info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s with a symlink", destPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	// Create the link under a temporary name and rename it into place, so an
+	// existing file or link is replaced atomically
+	for i := 0; ; i++ {
+		tmpPath := tempName(destPath)
+		err := os.Symlink(fileInfo.LinkTarget, tmpPath)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", destPath, err)
+		}
+		if err := s.applyMetadata(tmpPath, fileInfo); err != nil {
+			s.addError(destPath, err)
+		}
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to create symlink %s: %w", destPath, err)
+		}
+		break
+	}
+
+	s.incrementCopied(0)
+	return nil
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncPreservesSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "lib", "real.txt"), []byte("real"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	links := map[string]string{
+		"relative":   "lib/real.txt",
+		"dirlink":    "lib",
+		"broken":     "missing.txt",
+		"escaping":   "../outside.txt",
+		"absolute":   filepath.Join(sourceDir, "lib", "real.txt"),
+		"lib/parent": "../lib/real.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(sourceDir, name)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Links: true, SafeLinks: true, RewriteLinks: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"relative":   "lib/real.txt",
+		"dirlink":    "lib",
+		"broken":     "missing.txt",
+		"absolute":   filepath.Join("lib", "real.txt"), // Rewritten relative to the link
+		"lib/parent": "../lib/real.txt",
+	}
+	for name, want := range expected {
+		got, err := os.Readlink(filepath.Join(destDir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be a symlink: %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected %s -> %s, got %s", name, want, got)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(destDir, "escaping")); !os.IsNotExist(err) {
+		t.Error("Unsafe symlink should have been skipped")
+	}
+
+	// A second run must find the links up to date
+	syncer = New(Options{Recursive: true, Links: true, SafeLinks: true, RewriteLinks: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if syncer.stats.FilesCopied != 0 {
+		t.Errorf("Expected no files to be copied on second run, got %d", syncer.stats.FilesCopied)
+	}
+
+	// Changing a link target in the source updates the destination link
+	if err := os.Remove(filepath.Join(sourceDir, "relative")); err != nil {
+		t.Fatalf("Failed to remove symlink: %v", err)
+	}
+	if err := os.Symlink("lib/parent", filepath.Join(sourceDir, "relative")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	syncer = New(Options{Recursive: true, Links: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Third sync failed: %v", err)
+	}
+	if got, _ := os.Readlink(filepath.Join(destDir, "relative")); got != "lib/parent" {
+		t.Errorf("Expected updated link target lib/parent, got %s", got)
+	}
+}
+
+func TestSyncCopyLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+	sharedDir := filepath.Join(tmpDir, "shared")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.MkdirAll(sharedDir, 0755); err != nil {
+		t.Fatalf("Failed to create shared directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sharedDir, "data.txt"), []byte("shared data"), 0644); err != nil {
+		t.Fatalf("Failed to create shared file: %v", err)
+	}
+
+	if err := os.Symlink(sharedDir, filepath.Join(sourceDir, "shared")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(".", filepath.Join(sourceDir, "loop")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, CopyLinks: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join(destDir, "shared"))
+	if err != nil {
+		t.Fatalf("Expected shared directory in destination: %v", err)
+	}
+	if !info.IsDir() {
+		t.Error("Expected linked directory to be copied as a real directory")
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, "shared", "data.txt"))
+	if err != nil || string(content) != "shared data" {
+		t.Errorf("Expected linked directory contents to be copied, got %q (%v)", string(content), err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(destDir, "loop")); !os.IsNotExist(err) {
+		t.Error("Symlink loop should not have been followed")
+	}
+}
@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+)
+
+// permBits returns the permission bits of a mode, including setuid, setgid
+// and sticky
+func permBits(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// setFileMode records the mode and ownership of a scanned entry. Symlinks
+// that are copied as regular files take the attributes of their target.
+func (s *Syncer) setFileMode(fileInfo *FileInfo, path string, info os.FileInfo) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		if targetInfo, err := os.Stat(path); err == nil {
+			info = targetInfo
+		}
+	}
+	fileInfo.Mode = info.Mode()
+	fileInfo.Uid, fileInfo.Gid, _ = fileOwner(info)
+}
+
+// preserveOwner reports whether file owners are preserved. Changing the
+// owner of a file requires super-user privileges, so it is only attempted
+// when running as root.
+func (s *Syncer) preserveOwner() bool {
+	return s.options.Owner && os.Geteuid() == 0
+}
+
+// ownerArgs returns the uid and gid to pass to chown for a source entry,
+// using -1 for ids that are not preserved
+func (s *Syncer) ownerArgs(fileInfo FileInfo) (uid, gid int) {
+	uid, gid = -1, -1
+	if s.preserveOwner() {
+		uid = fileInfo.Uid
+	}
+	if s.options.Group {
+		gid = fileInfo.Gid
+	}
+	return uid, gid
+}
+
+// metadataDiffers reports whether the preserved attributes of a destination
+// entry differ from its source
+func (s *Syncer) metadataDiffers(sourceFile, destFile FileInfo) bool {
+	if s.options.Perms && !sourceFile.IsSymlink && permBits(sourceFile.Mode) != permBits(destFile.Mode) {
+		return true
+	}
+	if s.preserveOwner() && sourceFile.Uid >= 0 && sourceFile.Uid != destFile.Uid {
+		return true
+	}
+	if s.options.Group && sourceFile.Gid >= 0 && sourceFile.Gid != destFile.Gid {
+		return true
+	}
+	if s.preserveXattrs() && !sourceFile.IsSymlink && xattrsDiffer(sourceFile.Xattrs, destFile.Xattrs) {
+		return true
+	}
+	return false
+}
+
+// setTempMetadata gives a temporary file the permissions, ownership and
+// extended attributes the destination should end up with, before any data is
+// written to it
+func (s *Syncer) setTempMetadata(tmp *os.File, dst string, fileInfo FileInfo) error {
+	// Change ownership first, as chown clears the setuid and setgid bits
+	if uid, gid := s.ownerArgs(fileInfo); uid >= 0 || gid >= 0 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			s.addError(dst, fmt.Errorf("Failed to preserve ownership for %s: %w", dst, err))
+		}
+	}
+
+	if s.options.Perms {
+		if err := tmp.Chmod(permBits(fileInfo.Mode)); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+		}
+	} else if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Mode().IsRegular() {
+		// Keep the permissions of the file being replaced
+		if err := tmp.Chmod(dstInfo.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+		}
+	}
+
+	// ACLs go after the mode, as chmod rewrites the ACL mask
+	if err := s.applyXattrs(tmp.Name(), fileInfo); err != nil {
+		s.addError(dst, err)
+	}
+
+	return nil
+}
+
+// applyMetadata sets the preserved permissions, ownership and extended
+// attributes of an existing destination entry
+func (s *Syncer) applyMetadata(destPath string, fileInfo FileInfo) error {
+	if uid, gid := s.ownerArgs(fileInfo); uid >= 0 || gid >= 0 {
+		if err := os.Lchown(destPath, uid, gid); err != nil {
+			return fmt.Errorf("failed to preserve ownership for %s: %w", destPath, err)
+		}
+	}
+
+	if s.options.Perms && !fileInfo.IsSymlink {
+		if err := os.Chmod(destPath, permBits(fileInfo.Mode)); err != nil {
+			return fmt.Errorf("failed to preserve permissions for %s: %w", destPath, err)
+		}
+	}
+
+	return s.applyXattrs(destPath, fileInfo)
+}
+
+// syncMetadata fixes the attributes of a destination entry whose content is
+// already up to date
+func (s *Syncer) syncMetadata(destPath string, fileInfo FileInfo) error {
+	s.logAction("Updating attributes", "Would update attributes", "path", destPath)
+
+	if s.options.DryRun {
+		s.incrementMetadataToUpdate()
+		return nil
+	}
+
+	if err := s.applyMetadata(destPath, fileInfo); err != nil {
+		return err
+	}
+
+	s.incrementMetadataUpdated()
+	return nil
+}
+
+// applyDirectoryMetadata sets the permissions, ownership and modification
+// time of a destination directory. It runs once everything inside the
+// directory has been written and deleted, since both change the
+// modification time of the containing directory.
+func (s *Syncer) applyDirectoryMetadata(destPath string, dir FileInfo) {
+	info, err := os.Lstat(destPath)
+	if err != nil {
+		s.addError(destPath, fmt.Errorf("Failed to apply directory attributes to %s: %w", destPath, err))
+		return
+	}
+	if !info.IsDir() {
+		return
+	}
+
+	destDir := dir
+	destDir.Mode = info.Mode()
+	destDir.Uid, destDir.Gid, _ = fileOwner(info)
+	s.setXattrs(&destDir, destPath)
+	if s.metadataDiffers(dir, destDir) {
+		if err := s.applyMetadata(destPath, dir); err != nil {
+			s.addError(destPath, err)
+		}
+	}
+
+	if s.options.DirTimes && !info.ModTime().Equal(dir.ModTime) {
+		if err := os.Chtimes(destPath, dir.ModTime, dir.ModTime); err != nil {
+			s.addError(destPath, fmt.Errorf("Failed to preserve timestamps for %s: %w", destPath, err))
+		}
+	}
+}
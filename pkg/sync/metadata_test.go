@@ -0,0 +1,234 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncPreservesPermissions(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "private"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	scriptPath := filepath.Join(sourceDir, "run.sh")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	// Chmod is not subject to the umask
+	if err := os.Chmod(scriptPath, 0751|os.ModeSetgid); err != nil {
+		t.Fatalf("Failed to chmod source file: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(sourceDir, "private"), 0700); err != nil {
+		t.Fatalf("Failed to chmod source directory: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Perms: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(destDir, "run.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination file: %v", err)
+	}
+	if got := permBits(info.Mode()); got != 0751|os.ModeSetgid {
+		t.Errorf("Expected file mode %v, got %v", 0751|os.ModeSetgid, got)
+	}
+
+	info, err = os.Stat(filepath.Join(destDir, "private"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination directory: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0700 {
+		t.Errorf("Expected directory mode 0700, got %o", got)
+	}
+}
+
+func TestSyncUpdatesPermissionsWithoutCopying(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	sourceFile := filepath.Join(sourceDir, "file.txt")
+	if err := os.WriteFile(sourceFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	if err := New(Options{Recursive: true, Perms: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	if err := os.Chmod(sourceFile, 0600); err != nil {
+		t.Fatalf("Failed to chmod source file: %v", err)
+	}
+
+	// A dry run reports the change without applying it
+	preview := New(Options{Recursive: true, Perms: true, DryRun: true})
+	if err := preview.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if preview.stats.MetadataToUpdate != 1 || preview.stats.FilesToCopy != 0 {
+		t.Errorf("Expected 1 attribute update and no copies in preview, got %d and %d",
+			preview.stats.MetadataToUpdate, preview.stats.FilesToCopy)
+	}
+
+	syncer := New(Options{Recursive: true, Perms: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if syncer.stats.FilesCopied != 0 {
+		t.Errorf("Expected no files to be copied, got %d", syncer.stats.FilesCopied)
+	}
+	if syncer.stats.MetadataUpdated != 1 {
+		t.Errorf("Expected 1 attribute update, got %d", syncer.stats.MetadataUpdated)
+	}
+
+	info, err := os.Stat(filepath.Join(destDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination file: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("Expected mode 0600, got %o", got)
+	}
+}
+
+func TestSyncPreservesDirectoryTimes(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	nested := filepath.Join(sourceDir, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	dirTimes := map[string]time.Time{
+		"a":   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		"a/b": time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC),
+	}
+	for dir, mtime := range dirTimes {
+		if err := os.Chtimes(filepath.Join(sourceDir, dir), mtime, mtime); err != nil {
+			t.Fatalf("Failed to set directory times: %v", err)
+		}
+	}
+
+	// Directory times are left alone unless asked for
+	if err := New(Options{Recursive: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for dir, mtime := range dirTimes {
+		info, err := os.Stat(filepath.Join(destDir, dir))
+		if err != nil {
+			t.Fatalf("Failed to stat destination directory: %v", err)
+		}
+		if info.ModTime().Equal(mtime) {
+			t.Errorf("Expected %s mtime not to be preserved without DirTimes", dir)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, DirTimes: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	for dir, want := range dirTimes {
+		info, err := os.Stat(filepath.Join(destDir, dir))
+		if err != nil {
+			t.Fatalf("Failed to stat destination directory: %v", err)
+		}
+		if !info.ModTime().Equal(want) {
+			t.Errorf("Expected %s mtime %v, got %v", dir, want, info.ModTime())
+		}
+	}
+}
+
+func TestSyncEmptyDirectoryMetadata(t *testing.T) {
+	for _, threads := range []int{1, 4} {
+		tmpDir := t.TempDir()
+		sourceDir := filepath.Join(tmpDir, "source")
+		destDir := filepath.Join(tmpDir, "dest")
+
+		// A new empty directory gets its attributes even though nothing
+		// inside it holds it open until it has been created
+		empty := filepath.Join(sourceDir, "empty")
+		if err := os.MkdirAll(empty, 0755); err != nil {
+			t.Fatalf("Failed to create source directory: %v", err)
+		}
+		if err := os.Chmod(empty, 0550); err != nil {
+			t.Fatalf("Failed to change mode: %v", err)
+		}
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err := os.Chtimes(empty, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set directory times: %v", err)
+		}
+
+		syncer := New(Options{Recursive: true, Perms: true, DirTimes: true, Threads: threads})
+		if err := syncer.Sync(sourceDir, destDir); err != nil {
+			t.Fatalf("Sync with %d threads failed: %v", threads, err)
+		}
+
+		info, err := os.Stat(filepath.Join(destDir, "empty"))
+		if err != nil {
+			t.Fatalf("Failed to stat destination directory: %v", err)
+		}
+		if info.Mode().Perm() != 0550 {
+			t.Errorf("With %d threads: expected mode 0550, got %o", threads, info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("With %d threads: expected mtime %v, got %v", threads, mtime, info.ModTime())
+		}
+		if errs := syncer.Stats().FileErrors; len(errs) != 0 {
+			t.Errorf("With %d threads: unexpected errors: %v", threads, errs)
+		}
+	}
+}
+
+func TestSyncPreservesOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing file owners requires root")
+	}
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	sourceFile := filepath.Join(sourceDir, "file.txt")
+	if err := os.WriteFile(sourceFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.Chown(sourceFile, 1234, 5678); err != nil {
+		t.Fatalf("Failed to chown source file: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Owner: true, Group: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(destDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination file: %v", err)
+	}
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		t.Skip("Ownership is not available on this platform")
+	}
+	if uid != 1234 || gid != 5678 {
+		t.Errorf("Expected owner 1234:5678, got %d:%d", uid, gid)
+	}
+}
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsContentType is the content type of the output of WriteMetrics
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// lastSuccessMetric is the only metric carried over from an existing
+// metrics file, so that a failed run does not hide when the last good one
+// ended
+const lastSuccessMetric = "msync_last_success_timestamp_seconds"
+
+// metric is a gauge or counter of the Prometheus text format
+type metric struct {
+	name    string
+	help    string
+	value   float64
+	counter bool // Only ever increases, over all the syncs of the Syncer
+}
+
+// metrics returns the gauges of the current or last sync and the counters
+// of all syncs. lastSuccess is the end time of an earlier successful sync,
+// in seconds since the epoch, reported if this sync has not succeeded.
+func (s *Syncer) metrics(lastSuccess float64) []metric {
+	progress := s.Progress()
+
+	s.mu.Lock()
+	stats := s.stats
+	errorCount, verifyFailures := s.syncErrors, s.syncVerifyFailures
+	startTime, endTime, failure := s.startTime, s.endTime, s.failure
+	s.mu.Unlock()
+
+	running := !startTime.IsZero() && endTime.IsZero()
+	success := !startTime.IsZero() && !endTime.IsZero() && failure == nil && errorCount == 0 && verifyFailures == 0
+	if success {
+		lastSuccess = unixSeconds(endTime)
+	}
+
+	return []metric{
+		{"msync_running", "Whether a sync is running.", boolValue(running), false},
+		{"msync_success", "Whether the last sync ended without errors.", boolValue(success), false},
+		{"msync_start_timestamp_seconds", "Start time of the current or last sync.", unixSeconds(startTime), false},
+		{"msync_end_timestamp_seconds", "End time of the last sync.", unixSeconds(endTime), false},
+		{lastSuccessMetric, "End time of the last sync that ended without errors.", lastSuccess, false},
+		{"msync_duration_seconds", "Duration of the current or last sync.", progress.Elapsed.Seconds(), false},
+		{"msync_bytes_transferred", "Source bytes read by copies of the current or last sync so far.", float64(progress.BytesTransferred), false},
+		{"msync_files_found", "Source files found by the scan of the current or last sync so far.", float64(progress.FilesTotal), false},
+		{"msync_bytes_found", "Bytes of the source files found by the scan of the current or last sync so far.", float64(progress.BytesTotal), false},
+		{"msync_files_checked_total", "Files compared between source and destination.", float64(stats.FilesChecked), true},
+		{"msync_files_copied_total", "Files copied to the destination.", float64(stats.FilesCopied), true},
+		{"msync_files_deleted_total", "Files deleted from the destination.", float64(stats.FilesDeleted), true},
+		{"msync_dirs_created_total", "Directories created in the destination.", float64(stats.DirsCreated), true},
+		{"msync_bytes_copied_total", "Bytes of the files copied to the destination.", float64(stats.BytesCopied), true},
+		{"msync_bytes_deleted_total", "Bytes of the files deleted from the destination.", float64(stats.BytesDeleted), true},
+		{"msync_errors_total", "Errors of the syncs.", float64(len(stats.Errors)), true},
+		{"msync_verify_failures_total", "Copies that did not match the source after every retry.", float64(len(stats.VerifyFailures)), true},
+	}
+}
+
+// WriteMetrics writes the statistics of the current or last sync to w as
+// Prometheus gauges, and the counts that add up over syncs as counters,
+// labeled with the source and destination. It is safe to call while Sync
+// is running.
+func (s *Syncer) WriteMetrics(w io.Writer) error {
+	return s.writeMetrics(w, 0)
+}
+
+func (s *Syncer) writeMetrics(w io.Writer, lastSuccess float64) error {
+	s.mu.Lock()
+	labels := fmt.Sprintf(`{source="%s",destination="%s"}`, escapeLabel(s.source), escapeLabel(s.dest))
+	s.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range s.metrics(lastSuccess) {
+		kind := "gauge"
+		if m.counter {
+			kind = "counter"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n%s%s %s\n",
+			m.name, m.help, m.name, kind, m.name, labels, strconv.FormatFloat(m.value, 'g', -1, 64))
+	}
+	return bw.Flush()
+}
+
+// WriteMetricsFile writes the metrics of WriteMetrics to path for the
+// textfile collector of node_exporter. The file is replaced atomically, and
+// the last success time in an existing file is kept if this sync failed.
+func (s *Syncer) WriteMetricsFile(path string) error {
+	tmp, err := createTempFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	if err := s.writeMetrics(tmp, readLastSuccess(path)); err != nil {
+		discardTempFile(tmp)
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	// The collector needs to read the file, whatever the umask of cron
+	if err := tmp.Chmod(0644); err != nil {
+		discardTempFile(tmp)
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return commitTempFile(tmp, path)
+}
+
+// readLastSuccess returns the last success time recorded in the metrics file
+// at path, or 0 if there is none
+func readLastSuccess(path string) float64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, rest, ok := strings.Cut(line, "{")
+		if !ok || name != lastSuccessMetric {
+			continue
+		}
+		fields := strings.Fields(rest[strings.LastIndex(rest, "}")+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			return value
+		}
+	}
+	return 0
+}
+
+// escapeLabel escapes a label value of the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// unixSeconds returns t in seconds since the epoch, or 0 for the zero time
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
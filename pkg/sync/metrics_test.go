@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetricsFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+	metricsFile := filepath.Join(tmpDir, "msync.prom")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := syncer.WriteMetricsFile(metricsFile); err != nil {
+		t.Fatalf("WriteMetricsFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("Failed to read metrics file: %v", err)
+	}
+	metrics := string(data)
+	labels := `{source="` + sourceDir + `",destination="` + destDir + `"}`
+	for _, want := range []string{
+		"# TYPE msync_files_copied_total counter\n",
+		"msync_files_copied_total" + labels + " 1\n",
+		"msync_bytes_copied_total" + labels + " 7\n",
+		"msync_errors_total" + labels + " 0\n",
+		"# TYPE msync_success gauge\n",
+		"msync_success" + labels + " 1\n",
+		"msync_running" + labels + " 0\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, metrics)
+		}
+	}
+	lastSuccess := readLastSuccess(metricsFile)
+	if lastSuccess == 0 {
+		t.Fatalf("Expected a last success time, got:\n%s", metrics)
+	}
+
+	// A failed sync keeps the last success time of the file it replaces
+	failed := New(Options{Recursive: true})
+	if err := failed.Sync(filepath.Join(tmpDir, "missing"), destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := failed.WriteMetricsFile(metricsFile); err != nil {
+		t.Fatalf("WriteMetricsFile failed: %v", err)
+	}
+	data, err = os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("Failed to read metrics file: %v", err)
+	}
+	if !strings.Contains(string(data), "msync_success{source=\""+filepath.Join(tmpDir, "missing")+"\",destination=\""+destDir+"\"} 0\n") {
+		t.Errorf("Expected the failed sync to be reported, got:\n%s", data)
+	}
+	if got := readLastSuccess(metricsFile); got != lastSuccess {
+		t.Errorf("Expected last success time %v to be kept, got %v", lastSuccess, got)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		if isTempFile(entry.Name()) {
+			t.Errorf("Temporary file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestMetricsOfEachSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+
+	// A syncer reused like Watch does: a failed sync, then a good one
+	syncer := New(Options{Recursive: true})
+	if err := syncer.Sync(filepath.Join(tmpDir, "missing"), destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	firstStart := syncer.Report().StartTime
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if !syncer.Report().StartTime.After(firstStart) {
+		t.Errorf("Expected the start time of the second sync, got %v", syncer.Report().StartTime)
+	}
+	var buf strings.Builder
+	if err := syncer.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	labels := `{source="` + sourceDir + `",destination="` + destDir + `"}`
+	// The error counter keeps counting while success is that of the last sync
+	for _, want := range []string{
+		"msync_errors_total" + labels + " 1\n",
+		"msync_success" + labels + " 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+	if len(syncer.Stats().FileErrors) == 0 {
+		t.Error("Expected the statistics to keep the errors of the first sync")
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got, want := escapeLabel("a\\b\"c\nd"), `a\\b\"c\nd`; got != want {
+		t.Errorf("escapeLabel() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+const partialFileSuffix = ".msync-partial"
+
+// partialName returns the hidden name under which dst is transferred with
+// Partial. Unlike temporary files it is stable, so a later run finds it.
+func partialName(dst string) string {
+	dir, base := filepath.Split(dst)
+	return filepath.Join(dir, "."+base+partialFileSuffix)
+}
+
+// isPartialFile reports whether name looks like a partial file created by
+// partialCopyFile
+func isPartialFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, partialFileSuffix)
+}
+
+// partialCopyFile copies src to dst through a partial file that is kept if
+// the transfer fails. When a partial file from an earlier run exists, the
+// part of it that still matches src is kept and the copy resumes after it.
+func (s *Syncer) partialCopyFile(src, dst string, fileInfo FileInfo, tee io.Writer) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %w", src, err)
+	}
+	defer source.Close()
+
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file %s: %w", src, err)
+	}
+
+	partialPath := partialName(dst)
+	// Use 0666 like os.Create so the process umask applies to new files
+	partial, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file for %s: %w", dst, err)
+	}
+
+	partialInfo, err := partial.Stat()
+	if err != nil {
+		partial.Close()
+		return fmt.Errorf("failed to stat partial file %s: %w", partialPath, err)
+	}
+
+	// Keep only the verified prefix of an earlier attempt
+	resumeAt, err := verifiedPrefix(partial, source, partialInfo.Size(), sourceInfo.Size(), deltaBlockSize(sourceInfo.Size()))
+	if err != nil {
+		partial.Close()
+		return fmt.Errorf("failed to verify partial file %s: %w", partialPath, err)
+	}
+	if err := partial.Truncate(resumeAt); err != nil {
+		partial.Close()
+		return fmt.Errorf("failed to truncate partial file %s: %w", partialPath, err)
+	}
+
+	if resumeAt > 0 {
+		s.logger.Info("Resuming partial file", "path", partialPath, "offset", resumeAt)
+		s.incrementResumed(resumeAt)
+	} else {
+		s.logger.Debug("Writing to partial file", "path", partialPath)
+	}
+
+	// The kept prefix is not transferred, but it is part of the source data
+	if tee != nil {
+		if _, err := io.Copy(tee, io.NewSectionReader(source, 0, resumeAt)); err != nil {
+			partial.Close()
+			return fmt.Errorf("failed to read source file %s: %w", src, err)
+		}
+	}
+
+	if _, err := source.Seek(resumeAt, io.SeekStart); err != nil {
+		partial.Close()
+		return fmt.Errorf("failed to seek source file %s: %w", src, err)
+	}
+
+	var out io.Writer
+	var sparse *utils.SparseWriter
+	if s.options.Sparse {
+		sparse = utils.NewSparseWriter(partial)
+		sparse.Skip(resumeAt)
+		out = sparse
+	} else {
+		if _, err := partial.Seek(resumeAt, io.SeekStart); err != nil {
+			partial.Close()
+			return fmt.Errorf("failed to seek partial file %s: %w", partialPath, err)
+		}
+		out = partial
+	}
+
+	_, err = io.Copy(out, teeReader(s.throttleReader(source), tee))
+	if err == nil && sparse != nil {
+		err = sparse.Close()
+	}
+	if err != nil {
+		// Keep what was written so far for the next run
+		partial.Close()
+		return fmt.Errorf("failed to copy data, keeping partial file %s: %w", partialPath, err)
+	}
+
+	// The source mode may be read-only, which would keep a later run from
+	// reopening a partial file left by a failure, so it is only applied
+	// once the data is complete
+	if err := s.setTempMetadata(partial, dst, fileInfo); err != nil {
+		partial.Close()
+		return err
+	}
+
+	s.logger.Debug("Replacing destination file", "path", dst)
+
+	return commitTempFile(partial, dst)
+}
+
+// verifiedPrefix returns the length of the longest prefix of partial that
+// matches source, compared block by block by hash
+func verifiedPrefix(partial, source io.ReaderAt, partialSize, sourceSize int64, blockSize int) (int64, error) {
+	limit := min(partialSize, sourceSize)
+	partialBlock := make([]byte, blockSize)
+	sourceBlock := make([]byte, blockSize)
+
+	var offset int64
+	for offset < limit {
+		n := int(min(int64(blockSize), limit-offset))
+		if _, err := partial.ReadAt(partialBlock[:n], offset); err != nil {
+			return 0, err
+		}
+		if _, err := source.ReadAt(sourceBlock[:n], offset); err != nil {
+			return 0, err
+		}
+
+		partialSum := sha256.Sum256(partialBlock[:n])
+		sourceSum := sha256.Sum256(sourceBlock[:n])
+		if !bytes.Equal(partialSum[:], sourceSum[:]) {
+			break
+		}
+		offset += int64(n)
+	}
+
+	return offset, nil
+}
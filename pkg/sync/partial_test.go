@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifiedPrefix(t *testing.T) {
+	source := bytes.Repeat([]byte("0123456789abcdef"), 1024) // 16 KiB
+
+	tests := []struct {
+		name    string
+		partial []byte
+		want    int64
+	}{
+		{"empty", nil, 0},
+		{"matching prefix", source[:10000], 10000},
+		{"complete", source, int64(len(source))},
+		{"corrupt second block", append(append([]byte{}, source[:4096]...), bytes.Repeat([]byte("x"), 4096)...), 4096},
+		{"longer than source", append(append([]byte{}, source...), "extra"...), int64(len(source))},
+	}
+
+	for _, tt := range tests {
+		got, err := verifiedPrefix(bytes.NewReader(tt.partial), bytes.NewReader(source),
+			int64(len(tt.partial)), int64(len(source)), 4096)
+		if err != nil {
+			t.Fatalf("%s: verifiedPrefix failed: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSyncResumesPartialFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("resumable content "), 20000) // ~350 KiB
+	if err := os.WriteFile(filepath.Join(sourceDir, "large.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// An earlier run got most of the way before being interrupted, and the
+	// last bytes it wrote are garbage
+	partialPath := partialName(filepath.Join(destDir, "large.bin"))
+	partial := append(append([]byte{}, content[:200000]...), bytes.Repeat([]byte{0xff}, 8192)...)
+	if err := os.WriteFile(partialPath, partial, 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Partial: true, Delete: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destDir, "large.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read destination file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("Destination content differs from source")
+	}
+
+	if syncer.stats.ResumedBytes == 0 || syncer.stats.ResumedBytes > 200000 {
+		t.Errorf("Expected up to 200000 resumed bytes, got %d", syncer.stats.ResumedBytes)
+	}
+	if syncer.stats.FilesDeleted != 0 {
+		t.Errorf("Partial file should not be treated as extraneous, %d files deleted", syncer.stats.FilesDeleted)
+	}
+	if _, err := os.Stat(partialPath); !os.IsNotExist(err) {
+		t.Error("Partial file should be renamed into place")
+	}
+}
+
+func TestSyncResumesReadOnlyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	content := bytes.Repeat([]byte("read-only content "), 1<<16) // ~1.1 MiB
+	sourcePath := filepath.Join(sourceDir, "large.bin")
+	if err := os.WriteFile(sourcePath, content, 0444); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// Interrupt a slow first run part of the way through
+	options := Options{Recursive: true, Partial: true, Perms: true}
+	slow := options
+	slow.BwLimit = 1 << 20
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := New(slow).SyncContext(ctx, sourceDir, destDir); err == nil {
+		t.Fatal("Expected the interrupted sync to fail")
+	}
+
+	// The partial file stays writable so that it can be resumed, which
+	// also matters to users other than root
+	partialPath := partialName(filepath.Join(destDir, "large.bin"))
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		t.Fatalf("Expected a partial file to be kept: %v", err)
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		t.Errorf("Expected the partial file to be writable, got mode %o", info.Mode().Perm())
+	}
+
+	syncer := New(options)
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	destPath := filepath.Join(destDir, "large.bin")
+	got, err := os.ReadFile(destPath)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Expected large.bin to be copied: %v", err)
+	}
+	if info, err := os.Stat(destPath); err != nil || info.Mode().Perm() != 0444 {
+		t.Errorf("Expected mode 0444 on the copy, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if syncer.stats.ResumedBytes == 0 {
+		t.Error("Expected the partial file to be resumed")
+	}
+}
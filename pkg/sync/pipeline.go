@@ -0,0 +1,404 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// scanBufferSize is the number of scanned entries of each tree that may wait
+// to be compared
+const scanBufferSize = 1024
+
+// syncTask is a unit of work for the worker pool: a path found in the
+// source, the destination or both
+type syncTask struct {
+	source *scanEntry  // Nil if the path only exists in the destination
+	dest   *scanEntry  // Nil if the path only exists in the source
+	parent *dirState   // Destination directory the path is in
+	link   *linkLeader // For extra names of hard-linked files, the name to link to
+	leader *linkLeader // Set when the source is the leader of a hard link group
+}
+
+// dirState tracks the unfinished work inside a destination directory. Once
+// the merge has moved past the directory and everything inside it is done,
+// the directory is finished: its attributes are applied, or it is deleted if
+// it only exists in the destination.
+type dirState struct {
+	parent  *dirState
+	relPath string    // "" for the root
+	source  *FileInfo // Nil for a directory that only exists in the destination
+	pending int       // Unfinished tasks and subdirectories, including its own task, plus one while the merge is inside
+}
+
+// pipeline compares a source and a destination tree while they are being
+// scanned, and syncs each difference as soon as it is found
+type pipeline struct {
+	s           *Syncer
+	source      string
+	dest        string
+	sourceCache *checksumCache
+	destCache   *checksumCache
+	excluded    *excludedDirs // Destination directories holding excluded entries
+	tasks       chan syncTask
+	leaders     map[inodeKey]*linkLeader // Only used by merge
+	mu          sync.Mutex               // Guards the pending counts of dirState
+}
+
+// syncTrees scans and hashes source and destination concurrently and merges
+// the two sorted streams of entries, handing every path to the worker pool. Only the
+// directories being scanned, the tasks in flight and the leaders of hard
+// link groups are held in memory, however large the trees are.
+func (s *Syncer) syncTrees(source, destination string, destExists bool, only []string) {
+	p := &pipeline{
+		s:           s,
+		source:      source,
+		dest:        destination,
+		sourceCache: s.openChecksumCache(source),
+		tasks:       make(chan syncTask, s.options.Threads),
+		leaders:     make(map[inodeKey]*linkLeader),
+	}
+
+	sourceEntries := make(chan scanEntry, scanBufferSize)
+	destEntries := make(chan scanEntry, scanBufferSize)
+	s.emitPhase(PhaseScan)
+	limit := newScanLimit(only)
+	go s.scanTree(source, s.options.Filter, false, nil, limit, sourceEntries)
+	hashedSource := s.hashEntries(p.sourceCache, sourceEntries)
+	var hashedDest <-chan scanEntry = destEntries
+	if destExists {
+		p.destCache = s.openChecksumCache(destination)
+		// With DeleteExcluded the destination is scanned unfiltered, so
+		// excluded files show up as extraneous and get deleted
+		destFilter := s.options.Filter
+		if s.options.DeleteExcluded {
+			destFilter = nil
+		}
+		p.excluded = &excludedDirs{dirs: make(map[string]bool)}
+		go s.scanTree(destination, destFilter, true, p.excluded, limit, destEntries)
+		hashedDest = s.hashEntries(p.destCache, destEntries)
+	} else {
+		close(destEntries)
+	}
+
+	// Start workers
+	var wg sync.WaitGroup
+	for i := 0; i < s.options.Threads; i++ {
+		wg.Add(1)
+		go p.worker(&wg)
+	}
+
+	p.merge(hashedSource, hashedDest)
+	// After an abort the scanners stop at their next entry
+	for range hashedSource {
+	}
+	for range hashedDest {
+	}
+	s.progress.scanDone.Store(true)
+	s.emitPhase(PhaseTransfer)
+	close(p.tasks)
+	wg.Wait()
+
+	s.emitPhase(PhaseFinish)
+	// A dry run uses the caches, but must not write anything
+	for _, cache := range []*checksumCache{p.sourceCache, p.destCache} {
+		if cache != nil && !s.options.DryRun {
+			cache.keepUnscanned(limit)
+			if err := cache.save(); err != nil {
+				s.addError(cache.path, err)
+			}
+		}
+	}
+}
+
+// merge pairs up the entries of both trees by path and queues them
+func (p *pipeline) merge(sourceEntries, destEntries <-chan scanEntry) {
+	stack := []*dirState{{pending: 1}}
+
+	src, srcOK := <-sourceEntries
+	dst, dstOK := <-destEntries
+	for (srcOK || dstOK) && p.s.ctx.Err() == nil {
+		order := 0
+		if srcOK && dstOK {
+			order = comparePaths(src.file.Path, dst.file.Path)
+		}
+
+		var task syncTask
+		var relPath string
+		switch {
+		case !dstOK || (srcOK && order < 0):
+			entry := src
+			task.source = &entry
+			relPath = entry.file.Path
+			src, srcOK = <-sourceEntries
+		case !srcOK || order > 0:
+			entry := dst
+			task.dest = &entry
+			relPath = entry.file.Path
+			dst, dstOK = <-destEntries
+		default:
+			sourceEntry, destEntry := src, dst
+			task.source, task.dest = &sourceEntry, &destEntry
+			relPath = sourceEntry.file.Path
+			src, srcOK = <-sourceEntries
+			dst, dstOK = <-destEntries
+		}
+
+		// Directories are finished once the merge has left them
+		for len(stack) > 1 && !isWithin(relPath, stack[len(stack)-1].relPath) {
+			p.release(stack[len(stack)-1])
+			stack = stack[:len(stack)-1]
+		}
+
+		task.parent = stack[len(stack)-1]
+		if dir := p.queue(task); dir != nil {
+			stack = append(stack, dir)
+		}
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		p.release(stack[i])
+	}
+}
+
+// queue hands a task to the workers. For a directory it returns the state
+// that tracks the work inside it.
+func (p *pipeline) queue(task syncTask) *dirState {
+	var dir *dirState
+
+	if task.source == nil {
+		if !p.s.options.Delete {
+			return nil
+		}
+		if task.dest.file.IsDir {
+			// Deleted when finished, after its contents
+			dir = &dirState{parent: task.parent, relPath: task.dest.file.Path, pending: 1}
+			p.hold(task.parent)
+			return dir
+		}
+	} else {
+		if leader, isLeader := p.hardLinkLeader(task.source.file, task.destFile()); isLeader {
+			task.leader = leader
+		} else if leader != nil {
+			task.link = leader
+			task.source.file.HardLink = leader.path
+		}
+
+		if task.source.file.IsDir {
+			source := task.source.file
+			dir = &dirState{parent: task.parent, relPath: source.Path, source: &source, pending: 1}
+			p.hold(task.parent)
+			// Its attributes are applied once it has been created
+			task.parent = dir
+		}
+	}
+
+	if size, counted := task.progressSize(); counted {
+		p.s.progress.found(size)
+	}
+
+	p.hold(task.parent)
+	p.tasks <- task
+	return dir
+}
+
+// hold records unfinished work inside dir
+func (p *pipeline) hold(dir *dirState) {
+	p.mu.Lock()
+	dir.pending++
+	p.mu.Unlock()
+}
+
+// release marks work inside dir as done, finishing the directory and then
+// its parents if nothing else is left inside them
+func (p *pipeline) release(dir *dirState) {
+	for dir != nil {
+		p.mu.Lock()
+		dir.pending--
+		finished := dir.pending == 0
+		p.mu.Unlock()
+		if !finished {
+			return
+		}
+
+		// An aborted sync leaves directories as they are
+		if dir.relPath != "" && p.s.ctx.Err() == nil {
+			if dir.source == nil {
+				p.s.deleteExtra(p.dest, dir.relPath, p.excluded.holds(dir.relPath))
+			} else if !p.s.options.DryRun {
+				p.s.applyDirectoryMetadata(filepath.Join(p.dest, dir.relPath), *dir.source)
+			}
+		}
+		dir = dir.parent
+	}
+}
+
+// worker processes tasks until the queue is closed
+func (p *pipeline) worker(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for task := range p.tasks {
+		if p.s.ctx.Err() == nil {
+			p.run(task)
+			if size, counted := task.progressSize(); counted {
+				p.s.progress.finished(size)
+			}
+		} else if task.leader != nil {
+			// Let the other names of the group give up too
+			close(task.leader.done)
+		}
+		p.release(task.parent)
+	}
+}
+
+// run syncs, deletes or links a single path
+func (p *pipeline) run(task syncTask) {
+	s := p.s
+
+	if task.source == nil {
+		s.deleteExtra(p.dest, task.dest.file.Path, false)
+		return
+	}
+
+	// Extra names of hard-linked files are linked once their data is in place
+	if task.link != nil {
+		s.linkHardLink(p.dest, task.source.file, task.destFile(), task.link)
+		return
+	}
+
+	sourceFile := task.source.file
+	sourcePath := filepath.Join(p.source, sourceFile.Path)
+	destPath := filepath.Join(p.dest, sourceFile.Path)
+
+	var err error
+	reason := s.syncReason(sourceFile, task.destFile())
+	synced := reason != ""
+	switch {
+	case synced:
+		s.emitDecision(sourceFile.Path, fileAction(sourceFile), sourceFile.Size, reason)
+		if err = s.throttleFile(); err != nil {
+			break
+		}
+		if err = s.syncFile(sourcePath, destPath, sourceFile); err == nil {
+			s.printSyncItem(itemTransfer, sourceFile, task.destFile())
+			s.recordAction(sourceFile.Path, fileAction(sourceFile), sourceFile.Size, reason)
+		}
+	case task.dest != nil && !sourceFile.IsDir && s.metadataDiffers(sourceFile, task.dest.file):
+		s.emitDecision(sourceFile.Path, ActionMetadata, 0, "attributes changed")
+		if err = s.throttleFile(); err != nil {
+			break
+		}
+		if err = s.syncMetadata(destPath, sourceFile); err == nil {
+			s.printSyncItem(itemMetadata, sourceFile, task.destFile())
+			s.recordAction(sourceFile.Path, ActionMetadata, 0, "attributes changed")
+		}
+	case !sourceFile.IsDir:
+		s.emitDecision(sourceFile.Path, ActionSkip, 0, "unchanged")
+		s.recordAction(sourceFile.Path, ActionSkip, 0, "unchanged")
+	}
+	switch {
+	case err == nil:
+	case s.ctx.Err() != nil && errors.Is(err, context.Cause(s.ctx)):
+		// Stopped with the sync rather than failed
+		s.logger.Info("Abandoned copy of a stopped sync", "path", destPath)
+	case errors.Is(err, errVerifyMismatch):
+		s.addVerifyFailure(destPath, err)
+	default:
+		s.addError(destPath, err)
+	}
+
+	if task.leader != nil {
+		task.leader.synced = synced
+		close(task.leader.done)
+	}
+}
+
+// fileAction returns the action that syncs an entry of the source
+func fileAction(fileInfo FileInfo) string {
+	switch {
+	case fileInfo.IsDir:
+		return ActionMkdir
+	case fileInfo.IsSymlink:
+		return ActionSymlink
+	default:
+		return ActionCopy
+	}
+}
+
+// progressSize returns the number of bytes a task adds to the progress
+// totals, and whether it counts as a file at all. Directories and
+// deletions do not count, and symlinks and extra hard link names carry no
+// data.
+func (t syncTask) progressSize() (int64, bool) {
+	if t.source == nil || t.source.file.IsDir {
+		return 0, false
+	}
+	if t.source.file.IsSymlink || t.link != nil {
+		return 0, true
+	}
+	return t.source.file.Size, true
+}
+
+// destFile returns the destination entry of the task, if any
+func (t syncTask) destFile() *FileInfo {
+	if t.dest == nil {
+		return nil
+	}
+	return &t.dest.file
+}
+
+// deleteExtra removes a destination entry that does not exist in the
+// source. Directories are deleted after their contents. Excluded
+// destination files are never scanned and so never deleted themselves, and
+// a directory holding some, as reported by keep, is kept as well.
+func (s *Syncer) deleteExtra(root, relPath string, keep bool) {
+	fullPath := filepath.Join(root, relPath)
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return
+	}
+
+	if keep && info.IsDir() {
+		s.logger.Info("Keeping directory with excluded files", "path", fullPath)
+		s.emitDecision(relPath, ActionSkip, 0, "holds excluded files")
+		s.recordAction(relPath, ActionSkip, 0, "holds excluded files")
+		return
+	}
+
+	size, suffix := info.Size(), ""
+	if info.IsDir() {
+		size, suffix = 0, "/"
+	}
+
+	s.logAction("Deleting", "Would delete", "path", fullPath, "size", size)
+
+	if s.options.DryRun {
+		if !info.IsDir() {
+			s.incrementFileToDelete(size)
+		}
+		s.printItem("*deleting", relPath, suffix)
+		s.recordAction(relPath, ActionDelete, size, "")
+		s.emit(Event{Type: EventDelete, Root: root, Path: relPath, Size: size})
+		return
+	}
+
+	if s.throttleFile() != nil {
+		return
+	}
+
+	if err := os.RemoveAll(fullPath); err != nil {
+		s.addError(fullPath, fmt.Errorf("Failed to delete %s: %w", fullPath, err))
+		return
+	}
+
+	if !info.IsDir() {
+		s.incrementDeleted(size)
+	}
+	s.printItem("*deleting", relPath, suffix)
+	s.recordAction(relPath, ActionDelete, size, "")
+	s.emit(Event{Type: EventDelete, Root: root, Path: relPath, Size: size})
+}
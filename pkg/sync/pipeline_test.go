@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncDeletesExtraTrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "keep"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "keep", "file.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// Extraneous entries interleave with source entries in merge order
+	for _, name := range []string{"a/b/c.txt", "keep/old.txt", "keep-old/d.txt", "z.txt"} {
+		path := filepath.Join(destDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create destination directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("extra"), 0644); err != nil {
+			t.Fatalf("Failed to create destination file: %v", err)
+		}
+	}
+
+	// Deleting old.txt must not leave keep with a new mtime
+	mtime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(sourceDir, "keep"), mtime, mtime); err != nil {
+		t.Fatalf("Failed to set directory times: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Delete: true, DirTimes: true, Threads: 2})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(syncer.stats.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", syncer.stats.Errors)
+	}
+
+	for _, name := range []string{"a", "keep/old.txt", "keep-old", "z.txt"} {
+		if _, err := os.Lstat(filepath.Join(destDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+	if syncer.stats.FilesDeleted != 4 {
+		t.Errorf("Expected 4 files deleted, got %d", syncer.stats.FilesDeleted)
+	}
+
+	info, err := os.Stat(filepath.Join(destDir, "keep"))
+	if err != nil {
+		t.Fatalf("Failed to stat destination directory: %v", err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected keep mtime %v, got %v", mtime, info.ModTime())
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "keep", "file.txt")); err != nil {
+		t.Errorf("Expected keep/file.txt to be copied: %v", err)
+	}
+}
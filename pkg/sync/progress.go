@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a snapshot of how far a sync has got. The scan runs alongside
+// the copies, so the totals grow until ScanDone is set.
+type Progress struct {
+	FilesTotal       int64         // Source files found so far
+	BytesTotal       int64         // Size of the regular files among them
+	FilesDone        int64         // Files compared and, where needed, copied
+	BytesDone        int64         // Size of the regular files among them
+	BytesTransferred int64         // Source bytes read by copies, including files in progress
+	ScanDone         bool          // The totals are final
+	Elapsed          time.Duration // Time since the sync started
+	Active           []ActiveFile  // Files being copied
+}
+
+// ActiveFile is a file that is being copied
+type ActiveFile struct {
+	Slot int    // Copy slot, one per concurrent copy
+	Path string // Path relative to the tree root
+	Size int64
+	Done int64 // Source bytes read so far
+}
+
+// CurrentBytesDone returns BytesDone plus the parts of active files already
+// copied
+func (p Progress) CurrentBytesDone() int64 {
+	done := p.BytesDone
+	for _, file := range p.Active {
+		done += min(file.Done, file.Size)
+	}
+	return done
+}
+
+// Fraction returns the share of the bytes found so far that are done,
+// counting the parts of active files already copied
+func (p Progress) Fraction() float64 {
+	if p.BytesTotal == 0 {
+		if p.FilesTotal == 0 {
+			return 0
+		}
+		return float64(p.FilesDone) / float64(p.FilesTotal)
+	}
+	return min(float64(p.CurrentBytesDone())/float64(p.BytesTotal), 1)
+}
+
+// progressTracker counts the work found and done by a sync. Its zero value
+// is ready to use.
+type progressTracker struct {
+	filesTotal  atomic.Int64
+	bytesTotal  atomic.Int64
+	filesDone   atomic.Int64
+	bytesDone   atomic.Int64
+	transferred atomic.Int64
+	scanDone    atomic.Bool
+
+	mu     sync.Mutex
+	active []*activeCopy // Indexed by slot, nil for free slots
+}
+
+// activeCopy counts the source bytes of a file in progress as they are
+// written to it
+type activeCopy struct {
+	tracker *progressTracker
+	slot    int
+	path    string
+	size    int64
+	done    atomic.Int64
+}
+
+func (c *activeCopy) Write(p []byte) (int, error) {
+	c.done.Add(int64(len(p)))
+	c.tracker.transferred.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// reset clears the counts of an earlier sync
+func (t *progressTracker) reset() {
+	t.filesTotal.Store(0)
+	t.bytesTotal.Store(0)
+	t.filesDone.Store(0)
+	t.bytesDone.Store(0)
+	t.transferred.Store(0)
+	t.scanDone.Store(false)
+}
+
+// found records a source file found by the scan
+func (t *progressTracker) found(size int64) {
+	t.filesTotal.Add(1)
+	t.bytesTotal.Add(size)
+}
+
+// finished records a source file that needs no more work
+func (t *progressTracker) finished(size int64) {
+	t.filesDone.Add(1)
+	t.bytesDone.Add(size)
+}
+
+// begin records the start of a copy and returns the writer that counts its
+// source bytes
+func (t *progressTracker) begin(relPath string, size int64) *activeCopy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	slot := 0
+	for slot < len(t.active) && t.active[slot] != nil {
+		slot++
+	}
+	c := &activeCopy{tracker: t, slot: slot, path: relPath, size: size}
+	if slot == len(t.active) {
+		t.active = append(t.active, c)
+	} else {
+		t.active[slot] = c
+	}
+	return c
+}
+
+// end records the end of a copy
+func (t *progressTracker) end(c *activeCopy) {
+	t.mu.Lock()
+	t.active[c.slot] = nil
+	t.mu.Unlock()
+}
+
+// Progress returns how far the current or last sync has got. It is safe to
+// call while Sync is running.
+func (s *Syncer) Progress() Progress {
+	t := &s.progress
+	progress := Progress{
+		FilesTotal:       t.filesTotal.Load(),
+		BytesTotal:       t.bytesTotal.Load(),
+		FilesDone:        t.filesDone.Load(),
+		BytesDone:        t.bytesDone.Load(),
+		BytesTransferred: t.transferred.Load(),
+		ScanDone:         t.scanDone.Load(),
+	}
+
+	s.mu.Lock()
+	switch {
+	case !s.endTime.IsZero():
+		progress.Elapsed = s.endTime.Sub(s.startTime)
+	case !s.startTime.IsZero():
+		progress.Elapsed = time.Since(s.startTime)
+	}
+	s.mu.Unlock()
+
+	t.mu.Lock()
+	for _, c := range t.active {
+		if c != nil {
+			progress.Active = append(progress.Active, ActiveFile{Slot: c.slot, Path: c.path, Size: c.size, Done: c.done.Load()})
+		}
+	}
+	t.mu.Unlock()
+
+	return progress
+}
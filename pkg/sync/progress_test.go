@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	files := map[string][]byte{
+		"small.txt":     []byte("small"),
+		"sub/large.bin": bytes.Repeat([]byte("large "), 100000),
+	}
+	var totalBytes int64
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		totalBytes += int64(len(content))
+	}
+
+	syncer := New(Options{Recursive: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	progress := syncer.Progress()
+	if !progress.ScanDone {
+		t.Error("Expected the scan to be done")
+	}
+	if progress.FilesTotal != 2 || progress.FilesDone != 2 {
+		t.Errorf("Expected 2 of 2 files done, got %d of %d", progress.FilesDone, progress.FilesTotal)
+	}
+	if progress.BytesTotal != totalBytes || progress.BytesDone != totalBytes || progress.BytesTransferred != totalBytes {
+		t.Errorf("Expected %d bytes, got total %d, done %d, transferred %d",
+			totalBytes, progress.BytesTotal, progress.BytesDone, progress.BytesTransferred)
+	}
+	if len(progress.Active) != 0 {
+		t.Errorf("Expected no active files, got %v", progress.Active)
+	}
+	if progress.Fraction() != 1 {
+		t.Errorf("Expected fraction 1, got %f", progress.Fraction())
+	}
+
+	// Up to date files count as done without being transferred, and a
+	// reused syncer starts counting afresh
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	progress = syncer.Progress()
+	if progress.FilesTotal != 2 || progress.FilesDone != 2 {
+		t.Errorf("Expected 2 of 2 files done, got %d of %d", progress.FilesDone, progress.FilesTotal)
+	}
+	if progress.BytesDone != totalBytes || progress.BytesTransferred != 0 {
+		t.Errorf("Expected %d bytes done and none transferred, got %d and %d",
+			totalBytes, progress.BytesDone, progress.BytesTransferred)
+	}
+}
+
+func TestProgressTrackerSlots(t *testing.T) {
+	var tracker progressTracker
+	a := tracker.begin("a", 10)
+	b := tracker.begin("b", 20)
+	tracker.end(a)
+	c := tracker.begin("c", 30)
+
+	if b.slot != 1 || c.slot != 0 {
+		t.Errorf("Expected slots 1 and 0, got %d and %d", b.slot, c.slot)
+	}
+
+	c.Write([]byte("12345"))
+	if c.done.Load() != 5 || tracker.transferred.Load() != 5 {
+		t.Errorf("Expected 5 bytes counted, got %d and %d", c.done.Load(), tracker.transferred.Load())
+	}
+}
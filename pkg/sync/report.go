@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/osmontero/msync/pkg/tar"
+)
+
+// Actions of FileAction
+const (
+	ActionCopy     = "copy"     // File content written to the destination
+	ActionDelete   = "delete"   // Extraneous destination entry removed
+	ActionMkdir    = "mkdir"    // Directory created
+	ActionSymlink  = "symlink"  // Symlink created or retargeted
+	ActionHardlink = "hardlink" // Name linked to an already copied file
+	ActionMetadata = "metadata" // Permissions, ownership or attributes fixed
+	ActionSkip     = "skip"     // Nothing done, see Reason
+)
+
+// Classes of ErrorRecord
+const (
+	ErrorClassPermission = "permission" // Access denied
+	ErrorClassNotFound   = "not_found"  // File or directory vanished or never existed
+	ErrorClassNoSpace    = "no_space"   // Destination file system is full
+	ErrorClassChecksum   = "checksum"   // Copy did not match the source after every retry
+	ErrorClassGPG        = "gpg"        // GPG encryption, decryption or signature failed
+	ErrorClassIO         = "io"         // Other file system errors
+	ErrorClassOther      = "other"      // Errors not caused by a file system operation
+)
+
+// FileAction is what a sync did, or with DryRun would do, to one path
+type FileAction struct {
+	Path   string `json:"path"`             // Path relative to the tree root
+	Action string `json:"action"`           // One of the Action constants
+	Size   int64  `json:"size,omitempty"`   // Bytes copied or deleted
+	Reason string `json:"reason,omitempty"` // Why the file was copied or skipped
+}
+
+// ErrorRecord is an error of a sync with the path it concerns
+type ErrorRecord struct {
+	Path    string `json:"path"`
+	Class   string `json:"class"` // One of the ErrorClass constants
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+// Report is a machine-readable account of a sync
+type Report struct {
+	Source       string        `json:"source"`
+	Destination  string        `json:"destination"`
+	StartTime    time.Time     `json:"start_time"`
+	EndTime      time.Time     `json:"end_time"`
+	Duration     float64       `json:"duration_seconds"`
+	Options      Options       `json:"options"`
+	Stats        Stats         `json:"stats"`
+	Actions      []FileAction  `json:"actions"` // Only recorded with Options.Report
+	Errors       []ErrorRecord `json:"errors"`
+	Failure      string        `json:"failure,omitempty"`       // Error that stopped the sync, if any
+	FailureClass string        `json:"failure_class,omitempty"` // ErrorClass constant of Failure
+}
+
+// Report returns the report of the last sync
+func (s *Syncer) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := Report{
+		Source:      s.source,
+		Destination: s.dest,
+		StartTime:   s.startTime,
+		EndTime:     s.endTime,
+		Options:     s.options,
+		Stats:       s.statsLocked(),
+		Actions:     append([]FileAction{}, s.actions...),
+		Errors:      append([]ErrorRecord{}, s.stats.FileErrors...),
+	}
+	if !s.endTime.IsZero() {
+		report.Duration = s.endTime.Sub(s.startTime).Seconds()
+	}
+	if s.failure != nil {
+		report.Failure = s.failure.Error()
+		report.FailureClass = errorClass(s.failure)
+	}
+	return report
+}
+
+// WriteJSON writes the report to w as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// recordAction adds the action taken for relPath to the report
+func (s *Syncer) recordAction(relPath, action string, size int64, reason string) {
+	if !s.options.Report {
+		return
+	}
+
+	s.mu.Lock()
+	s.actions = append(s.actions, FileAction{
+		Path:   filepath.ToSlash(relPath),
+		Action: action,
+		Size:   size,
+		Reason: reason,
+	})
+	s.mu.Unlock()
+}
+
+// errorClass sorts an error into one of the ErrorClass constants
+func errorClass(err error) string {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, errVerifyMismatch):
+		return ErrorClassChecksum
+	case errors.Is(err, tar.ErrGPG):
+		return ErrorClassGPG
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorClassPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorClassNotFound
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorClassNoSpace
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &errno):
+		return ErrorClassIO
+	default:
+		return ErrorClassOther
+	}
+}
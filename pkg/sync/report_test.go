@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osmontero/msync/pkg/tar"
+)
+
+func TestSyncReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	for _, dir := range []string{filepath.Join(sourceDir, "sub"), destDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(sourceDir, "new.txt"):      "new",
+		filepath.Join(sourceDir, "same.txt"):     "same",
+		filepath.Join(sourceDir, "sub", "a.txt"): "sub",
+		filepath.Join(destDir, "same.txt"):       "same",
+		filepath.Join(destDir, "extraneous.txt"): "delete me",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Delete: true, Method: "size", Report: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	report := syncer.Report()
+	if report.Source != sourceDir || report.Destination != destDir {
+		t.Errorf("Unexpected report paths %s, %s", report.Source, report.Destination)
+	}
+	if report.EndTime.Before(report.StartTime) {
+		t.Errorf("End time %v is before start time %v", report.EndTime, report.StartTime)
+	}
+
+	actions := make(map[string]FileAction)
+	for _, action := range report.Actions {
+		actions[action.Path] = action
+	}
+	expected := map[string]string{
+		"new.txt":        ActionCopy,
+		"same.txt":       ActionSkip,
+		"sub":            ActionMkdir,
+		"sub/a.txt":      ActionCopy,
+		"extraneous.txt": ActionDelete,
+	}
+	for path, action := range expected {
+		if actions[path].Action != action {
+			t.Errorf("Expected %s for %s, got %+v", action, path, actions[path])
+		}
+	}
+	if reason := actions["new.txt"].Reason; reason != "new" {
+		t.Errorf("Expected reason new for new.txt, got %q", reason)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	stats, ok := decoded["stats"].(map[string]any)
+	if !ok || stats["files_copied"] != float64(2) || stats["files_deleted"] != float64(1) {
+		t.Errorf("Unexpected stats in report: %v", decoded["stats"])
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed: %w", &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}), ErrorClassPermission},
+		{fmt.Errorf("failed: %w", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}), ErrorClassNotFound},
+		{&os.LinkError{Op: "rename", Old: "a", New: "b", Err: os.ErrInvalid}, ErrorClassIO},
+		{fmt.Errorf("%w after 3 attempts", errVerifyMismatch), ErrorClassChecksum},
+		{fmt.Errorf("failed to extract source TAR: %w", tar.ErrGPG), ErrorClassGPG},
+		{errors.New("something else"), ErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSyncMaxErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	// Every source directory clashes with a destination file, so none of
+	// the files inside can be copied
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		t.Fatalf("Failed to create destination directory: %v", err)
+	}
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		if err := os.MkdirAll(filepath.Join(sourceDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		for i := 0; i < 5; i++ {
+			name := filepath.Join(sourceDir, dir, fmt.Sprintf("%d.txt", i))
+			if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+				t.Fatalf("Failed to create %s: %v", name, err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(destDir, dir), []byte("file"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Threads: 1})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync without an error limit failed: %v", err)
+	}
+	all := len(syncer.Stats().FileErrors)
+	if all < 20 {
+		t.Fatalf("Expected an error for every file, got %d", all)
+	}
+	for _, record := range syncer.Stats().FileErrors {
+		if record.Err == nil || record.Class == "" {
+			t.Errorf("Expected a classified error, got %+v", record)
+		}
+	}
+
+	syncer = New(Options{Recursive: true, Threads: 1, MaxErrors: 3})
+	err := syncer.Sync(sourceDir, destDir)
+	if !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("Expected ErrTooManyErrors, got %v", err)
+	}
+	if got := len(syncer.Stats().FileErrors); got < 3 || got >= all {
+		t.Errorf("Expected the sync to stop after 3 of %d errors, got %d", all, got)
+	}
+	if report := syncer.Report(); report.Failure != err.Error() || report.FailureClass != ErrorClassOther {
+		t.Errorf("Expected the abort in the report, got %q (%s)", report.Failure, report.FailureClass)
+	}
+
+	// The limit applies to each sync of a reused syncer, as in Watch
+	before := len(syncer.Stats().FileErrors)
+	if err := syncer.Sync(sourceDir, destDir); !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("Expected ErrTooManyErrors from the second sync, got %v", err)
+	}
+	if got := len(syncer.Stats().FileErrors) - before; got < 3 || got >= all {
+		t.Errorf("Expected the second sync to stop after 3 of %d errors, got %d", all, got)
+	}
+}
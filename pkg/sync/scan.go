@@ -0,0 +1,426 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/osmontero/msync/pkg/filter"
+)
+
+// scanEntry is an entry of a tree found by scanTree
+type scanEntry struct {
+	file FileInfo
+	path string      // Full path of the entry
+	info os.FileInfo // What the entry was scanned as, the target for copied symlinks
+	hash bool        // Whether the checksum still has to be calculated
+}
+
+// dirListing holds the entries of a directory read ahead of the scan
+type dirListing struct {
+	done  chan struct{}
+	infos []os.FileInfo
+}
+
+// treeScanner streams the entries of one tree
+type treeScanner struct {
+	s          *Syncer
+	root       string
+	matcher    *filter.Matcher
+	removeTemp bool          // Remove stale temporary files found on the way
+	excluded   *excludedDirs // Records the directories holding excluded entries, if not nil
+	readers    chan struct{} // Limits concurrent directory reads to Threads
+	limit      *scanLimit    // Paths the scan is limited to, nil for the whole tree
+	out        chan<- scanEntry
+}
+
+// scanLimit restricts a scan to some paths of a tree. Everything inside
+// them is scanned, as are the directories leading to them, but not the
+// rest of those directories.
+type scanLimit struct {
+	paths map[string]bool
+	dirs  map[string]bool // Directories leading to paths
+}
+
+// newScanLimit returns the limit to the relative paths given, or nil if
+// there are none
+func newScanLimit(paths []string) *scanLimit {
+	if len(paths) == 0 {
+		return nil
+	}
+	limit := &scanLimit{paths: make(map[string]bool), dirs: make(map[string]bool)}
+	for _, path := range paths {
+		limit.paths[path] = true
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			limit.dirs[dir] = true
+		}
+	}
+	return limit
+}
+
+// includes reports whether relPath is scanned under the limit
+func (l *scanLimit) includes(relPath string) bool {
+	if l == nil || l.dirs[relPath] {
+		return true
+	}
+	for path := relPath; path != "."; path = filepath.Dir(path) {
+		if l.paths[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedDirs records the directories of a tree that hold entries left out
+// by the filter, so that deleting extraneous directories keeps them
+type excludedDirs struct {
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+// add records the directories containing the excluded relPath
+func (e *excludedDirs) add(relPath string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for dir := filepath.Dir(relPath); dir != "." && !e.dirs[dir]; dir = filepath.Dir(dir) {
+		e.dirs[dir] = true
+	}
+}
+
+// holds reports whether the directory relDir contains excluded entries
+func (e *excludedDirs) holds(relDir string) bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.dirs[relDir]
+}
+
+// scanTree sends the entries of the tree at root to out and closes it. The
+// entries of a directory follow the directory itself, sorted by name, so two
+// trees scanned this way can be merged by comparing paths with comparePaths.
+// Up to Threads subdirectories are read ahead of the scan, so memory use
+// depends on the size and depth of directories rather than on the size of
+// the tree. Like filepath.Walk, a symlink at root is not followed. If limit
+// is not nil, only the paths it includes are sent. If excluded is not nil,
+// the directories holding entries excluded by rules are recorded in it.
+func (s *Syncer) scanTree(root string, rules *filter.Filter, removeTemp bool, excluded *excludedDirs, limit *scanLimit, out chan<- scanEntry) {
+	defer close(out)
+
+	ts := &treeScanner{
+		s:          s,
+		root:       root,
+		matcher:    rules.Matcher(root),
+		removeTemp: removeTemp,
+		excluded:   excluded,
+		readers:    make(chan struct{}, s.options.Threads),
+		limit:      limit,
+		out:        out,
+	}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		s.addError(root, fmt.Errorf("Error accessing %s: %w", root, err))
+		return
+	}
+	if !info.IsDir() {
+		return
+	}
+
+	s.loadIgnoreFiles(ts.matcher, ".")
+	ts.walk(root, "", ts.readAhead(root))
+}
+
+// readAhead starts reading the entries of dir in the background
+func (ts *treeScanner) readAhead(dir string) *dirListing {
+	listing := &dirListing{done: make(chan struct{})}
+
+	go func() {
+		defer close(listing.done)
+		ts.readers <- struct{}{}
+		defer func() { <-ts.readers }()
+
+		// ReadDir sorts entries by name
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			ts.s.addError(dir, fmt.Errorf("Error accessing %s: %w", dir, err))
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				ts.s.addError(filepath.Join(dir, entry.Name()), fmt.Errorf("Error accessing %s: %w", filepath.Join(dir, entry.Name()), err))
+				continue
+			}
+			listing.infos = append(listing.infos, info)
+		}
+	}()
+
+	return listing
+}
+
+// walk sends the entries below dir, whose listing has been started
+func (ts *treeScanner) walk(dir, relDir string, listing *dirListing) {
+	<-listing.done
+
+	// All entries of the directory are checked before any is descended
+	// into, so the subdirectories to read ahead are known
+	type child struct {
+		entry   scanEntry
+		emit    bool
+		descend bool
+	}
+	children := make([]child, 0, len(listing.infos))
+	var subdirs []string
+	for _, info := range listing.infos {
+		relPath := filepath.Join(relDir, info.Name())
+		if !ts.limit.includes(relPath) {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		entry, emit, descend := ts.visit(path, relPath, info)
+		if !emit && !descend {
+			continue
+		}
+		children = append(children, child{entry, emit, descend})
+		if descend {
+			subdirs = append(subdirs, path)
+		}
+	}
+	listing.infos = nil
+
+	// Keep up to Threads subdirectories read ahead
+	listings := make([]*dirListing, len(subdirs))
+	for i := 0; i < len(subdirs) && i < ts.s.options.Threads; i++ {
+		listings[i] = ts.readAhead(subdirs[i])
+	}
+
+	next := 0
+	for _, c := range children {
+		if ts.s.ctx.Err() != nil {
+			return
+		}
+		if c.emit {
+			ts.s.emit(Event{Type: EventFileScanned, Root: ts.root, Path: c.entry.file.Path, Size: c.entry.file.Size})
+			select {
+			case ts.out <- c.entry:
+			case <-ts.s.ctx.Done():
+				return
+			}
+		}
+		if c.descend {
+			if ahead := next + ts.s.options.Threads; ahead < len(subdirs) {
+				listings[ahead] = ts.readAhead(subdirs[ahead])
+			}
+			ts.walk(c.entry.path, c.entry.file.Path, listings[next])
+			listings[next] = nil
+			next++
+		}
+	}
+}
+
+// visit builds the entry for path. It reports whether the entry is part of
+// the tree and whether it is a directory to descend into.
+func (ts *treeScanner) visit(path, relPath string, info os.FileInfo) (scanEntry, bool, bool) {
+	s := ts.s
+
+	// Never treat our own temporary and partial files as part of the tree
+	if !info.IsDir() && isTempFile(info.Name()) {
+		if ts.removeTemp {
+			s.removeStaleTempFile(path)
+		}
+		return scanEntry{}, false, false
+	}
+	if !info.IsDir() && isPartialFile(info.Name()) {
+		return scanEntry{}, false, false
+	}
+
+	// With CopyLinks, symlinks are replaced by what they point to
+	isLink := info.Mode()&os.ModeSymlink != 0
+	if isLink && s.options.CopyLinks {
+		targetInfo, err := os.Stat(path)
+		if err != nil {
+			if s.options.SkipBrokenLinks {
+				s.logger.Info("Skipping broken symlink", "path", path)
+			} else {
+				s.addError(path, fmt.Errorf("Symlink %s has no referent: %w", path, err))
+			}
+			return scanEntry{}, false, false
+		}
+		if targetInfo.IsDir() && !s.followLinkedDir(path) {
+			return scanEntry{}, false, false
+		}
+		info = targetInfo
+		isLink = false
+	}
+
+	// Skip excluded paths, including everything below excluded directories
+	if ts.matcher.Excluded(relPath, info.IsDir()) {
+		if ts.excluded != nil {
+			ts.excluded.add(relPath)
+		}
+		return scanEntry{}, false, false
+	}
+
+	// Skip subdirectories if not recursive
+	if !s.options.Recursive && info.IsDir() && filepath.Dir(relPath) != "." {
+		return scanEntry{}, false, false
+	}
+
+	if info.IsDir() {
+		s.loadIgnoreFiles(ts.matcher, relPath)
+	}
+
+	if isLink && s.options.Links {
+		fileInfo, ok := s.symlinkInfo(ts.root, path, relPath, info)
+		if ok {
+			s.incrementChecked()
+		}
+		return scanEntry{file: fileInfo, path: path, info: info}, ok, false
+	}
+
+	entry := scanEntry{
+		file: FileInfo{
+			Path:    relPath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		},
+		path: path,
+		info: info,
+	}
+	s.setFileMode(&entry.file, path, info)
+	s.setFileID(&entry.file, info)
+	s.setXattrs(&entry.file, path)
+
+	// Checksums of regular files are calculated later by the workers
+	entry.hash = s.shouldCalculateChecksum() && !info.IsDir()
+	if entry.hash && isLink {
+		// For symlinks, check if target exists
+		if _, err := os.Stat(path); err != nil {
+			// Broken symlink - handle based on options
+			if s.options.SkipBrokenLinks {
+				s.logger.Info("Skipping broken symlink", "path", path)
+				return scanEntry{}, false, false // Skip this file entirely
+			}
+			// Just skip checksum calculation but include the file
+			s.logger.Warn("Not hashing broken symlink", "path", path)
+			entry.hash = false
+		}
+	}
+
+	s.incrementChecked()
+	return entry, true, info.IsDir()
+}
+
+// hashJob is a scanned entry in the hashing stage. done is closed once its
+// checksum has been calculated, and is nil if there is none to calculate.
+type hashJob struct {
+	entry scanEntry
+	done  chan struct{}
+}
+
+// hashEntries calculates the checksums of the entries scanned into in with
+// a pool of Threads workers of its own, so hashing neither waits for nor
+// holds up the copies. The entries come out of the returned channel in the
+// order they were scanned.
+func (s *Syncer) hashEntries(cache *checksumCache, in <-chan scanEntry) <-chan scanEntry {
+	if !s.shouldCalculateChecksum() {
+		return in
+	}
+
+	out := make(chan scanEntry, scanBufferSize)
+	ordered := make(chan *hashJob, scanBufferSize)
+	jobs := make(chan *hashJob, s.options.Threads)
+
+	for i := 0; i < s.options.Threads; i++ {
+		go func() {
+			for job := range jobs {
+				// An aborted sync has no use for more checksums
+				if s.ctx.Err() == nil {
+					s.hashEntry(cache, &job.entry)
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for entry := range in {
+			job := &hashJob{entry: entry}
+			if entry.hash {
+				job.done = make(chan struct{})
+			}
+			ordered <- job
+			if job.done != nil {
+				jobs <- job
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for job := range ordered {
+			if job.done != nil {
+				<-job.done
+			}
+			out <- job.entry
+		}
+	}()
+
+	return out
+}
+
+// hashEntry calculates the checksum of a scanned file if it is needed
+func (s *Syncer) hashEntry(cache *checksumCache, entry *scanEntry) {
+	if entry == nil || !entry.hash {
+		return
+	}
+	entry.hash = false
+
+	checksum, err := s.fileChecksum(cache, entry.file.Path, entry.path, entry.info)
+	if err != nil {
+		if entry.info.Mode()&os.ModeSymlink != 0 {
+			s.addError(entry.path, fmt.Errorf("Failed to calculate checksum for symlink %s: %w", entry.path, err))
+		} else {
+			s.addError(entry.path, fmt.Errorf("Failed to calculate checksum for %s: %w", entry.path, err))
+		}
+		return
+	}
+	entry.file.Checksum = checksum
+	entry.file.ChecksumAlgo = s.options.ChecksumAlgo
+}
+
+// comparePaths orders relative paths the way scanTree sends them: by name
+// within a directory, with the contents of a directory right after it
+func comparePaths(a, b string) int {
+	const sep = string(filepath.Separator)
+	for {
+		aName, aRest, aMore := strings.Cut(a, sep)
+		bName, bRest, bMore := strings.Cut(b, sep)
+		if c := strings.Compare(aName, bName); c != 0 {
+			return c
+		}
+		switch {
+		case !aMore && !bMore:
+			return 0
+		case !aMore:
+			return -1
+		case !bMore:
+			return 1
+		}
+		a, b = aRest, bRest
+	}
+}
+
+// isWithin reports whether relPath lies below the directory relDir, where
+// "" is the root
+func isWithin(relPath, relDir string) bool {
+	return relDir == "" || strings.HasPrefix(relPath, relDir+string(filepath.Separator))
+}
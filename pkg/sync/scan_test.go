@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osmontero/msync/pkg/filter"
+)
+
+func TestScanTree(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A tree wide and deep enough to keep several readers busy
+	want := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			dir := filepath.Join(fmt.Sprintf("d%d", i), fmt.Sprintf("e%d", j))
+			if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			want[filepath.Dir(dir)] = true
+			want[dir] = true
+
+			for k := 0; k < 4; k++ {
+				name := filepath.Join(dir, fmt.Sprintf("file%d.txt", k))
+				if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+					t.Fatalf("Failed to create file: %v", err)
+				}
+				want[name] = true
+			}
+			name := filepath.Join(dir, "skip.log")
+			if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("log"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+	}
+
+	// Rules from an ignore file must reach directories read ahead
+	if err := os.WriteFile(filepath.Join(tmpDir, "d3", ".msyncignore"), []byte("*.txt\n"), 0644); err != nil {
+		t.Fatalf("Failed to create ignore file: %v", err)
+	}
+	want[filepath.Join("d3", ".msyncignore")] = true
+	for name := range want {
+		if filepath.Dir(filepath.Dir(name)) == "d3" && filepath.Ext(name) == ".txt" {
+			delete(want, name)
+		}
+	}
+
+	rules := filter.New()
+	if err := rules.AddExclude("*.log"); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	rules.AddIgnoreFile(".msyncignore")
+
+	syncer := New(Options{Recursive: true, Method: "checksum", Threads: 8})
+	entries := make(chan scanEntry, scanBufferSize)
+	go syncer.scanTree(tmpDir, rules, false, nil, nil, entries)
+
+	files := make(map[string]FileInfo)
+	previous := ""
+	for entry := range entries {
+		if previous != "" && comparePaths(previous, entry.file.Path) >= 0 {
+			t.Errorf("Entry %s sent after %s", entry.file.Path, previous)
+		}
+		previous = entry.file.Path
+
+		syncer.hashEntry(nil, &entry)
+		files[entry.file.Path] = entry.file
+	}
+	if len(syncer.stats.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", syncer.stats.Errors)
+	}
+
+	if len(files) != len(want) {
+		t.Errorf("Expected %d entries, got %d", len(want), len(files))
+	}
+	for name := range want {
+		fileInfo, ok := files[name]
+		if !ok {
+			t.Errorf("Missing entry %s", name)
+			continue
+		}
+		if fileInfo.IsDir {
+			continue
+		}
+		checksum, err := syncer.calculateChecksum(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("Failed to calculate checksum: %v", err)
+		}
+		if fileInfo.Checksum != checksum {
+			t.Errorf("Expected checksum %s for %s, got %q", checksum, name, fileInfo.Checksum)
+		}
+	}
+}
+
+func TestComparePaths(t *testing.T) {
+	sep := string(filepath.Separator)
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"a", "a", 0},
+		{"a", "b", -1},
+		{"a", "a" + sep + "b", -1},
+		// The contents of a directory come before its next sibling, even
+		// if the sibling's name sorts before the separator
+		{"a" + sep + "z", "a-b", -1},
+		{"a-b", "a" + sep + "z", 1},
+		{"a" + sep + "b" + sep + "c", "a" + sep + "c", -1},
+	}
+
+	for _, test := range tests {
+		if got := comparePaths(test.a, test.b); got != test.want {
+			t.Errorf("comparePaths(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// copySparse copies the data regions of source into destination and leaves
+// holes everywhere else, so sparse files keep their on-disk size. If tee is
+// not nil, the full source content, holes included, is written to it. Only
+// the data regions are throttled under the copy bandwidth.
+func (s *Syncer) copySparse(destination, source *os.File, tee io.Writer) (int64, error) {
+	info, err := source.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	s.logger.Debug("Writing sparse file", "path", destination.Name())
+
+	var read io.Writer
+	if s.bwLimiter != nil {
+		read = throttleWriter{s.ctx, s.bwLimiter}
+	}
+	return utils.CopySparse(destination, source, info.Size(), tee, read)
+}
@@ -0,0 +1,109 @@
+//go:build linux
+
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// createSparseFile writes a 4 MiB file with data only in its middle
+func createSparseFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create sparse file: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(4 << 20); err != nil {
+		t.Fatalf("Failed to size sparse file: %v", err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte("data"), 2048), 2<<20); err != nil {
+		t.Fatalf("Failed to write sparse file: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read sparse file: %v", err)
+	}
+	return content
+}
+
+// allocatedBytes returns the disk space used by a file
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestSyncSparseFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	sourcePath := filepath.Join(sourceDir, "disk.img")
+	content := createSparseFile(t, sourcePath)
+	if allocatedBytes(t, sourcePath) >= int64(len(content)) {
+		t.Skip("File system does not support sparse files")
+	}
+
+	if err := New(Options{Recursive: true, Sparse: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	destPath := filepath.Join(destDir, "disk.img")
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("Failed to read destination file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("Destination content differs from source")
+	}
+
+	if used := allocatedBytes(t, destPath); used > allocatedBytes(t, sourcePath) {
+		t.Errorf("Expected destination to stay sparse, uses %d bytes", used)
+	}
+}
+
+func TestSyncSparseFileBwLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	sourcePath := filepath.Join(sourceDir, "disk.img")
+	content := createSparseFile(t, sourcePath)
+	if allocatedBytes(t, sourcePath) >= int64(len(content)) {
+		t.Skip("File system does not support sparse files")
+	}
+
+	// Only the 8 KiB of data are read, the holes are not throttled
+	syncer := New(Options{Recursive: true, Sparse: true, BwLimit: 1 << 20})
+	start := time.Now()
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the holes not to be throttled, took %v", elapsed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destDir, "disk.img"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Expected disk.img to be copied: %v", err)
+	}
+}
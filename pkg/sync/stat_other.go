@@ -0,0 +1,11 @@
+//go:build !unix
+
+package sync
+
+import "os"
+
+// fileOwner returns the numeric owner and group of a file. Ownership is not
+// available on this platform.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
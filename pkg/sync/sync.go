@@ -1,9 +1,12 @@
 package sync
 
 import (
-	"crypto/sha256"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,26 +14,60 @@ import (
 	"time"
 
 	"github.com/osmontero/msync/internal/utils"
+	"github.com/osmontero/msync/pkg/filter"
 	"github.com/osmontero/msync/pkg/tar"
 )
 
 // Options holds configuration for the synchronization process
 type Options struct {
-	Checksum      bool   // Use checksum comparison
-	DryRun        bool   // Show what would be copied without copying
-	Interactive   bool   // Interactive mode (not used in sync package directly)
-	Verbose       bool   // Enable verbose output
-	Recursive     bool   // Recursively sync directories
-	Delete        bool   // Delete extraneous files from destination
-	Threads       int    // Number of concurrent threads
-	Method        string // Comparison method: mtime, checksum, size
-	SkipBrokenLinks bool // Skip broken symbolic links instead of reporting errors
+	Checksum        bool            `json:"checksum"`              // Use checksum comparison
+	DryRun          bool            `json:"dry_run"`               // Show what would be copied without copying
+	Interactive     bool            `json:"interactive"`           // Interactive mode (not used in sync package directly)
+	Verbose         bool            `json:"verbose"`               // Write a summary to Output when the sync ends
+	Recursive       bool            `json:"recursive"`             // Recursively sync directories
+	Delete          bool            `json:"delete"`                // Delete extraneous files from destination
+	Threads         int             `json:"threads"`               // Number of concurrent threads
+	Method          string          `json:"method"`                // Comparison method: mtime, checksum, size
+	ChecksumAlgo    string          `json:"checksum_algo"`         // Checksum algorithm: sha256, sha512, blake2b, xxh64, xxh3, crc32c
+	SkipBrokenLinks bool            `json:"skip_broken_links"`     // Skip broken symbolic links instead of reporting errors
+	Filter          *filter.Filter  `json:"-"`                     // Include/exclude rules and ignore files applied to source and destination
+	DeleteExcluded  bool            `json:"delete_excluded"`       // Also delete excluded files from destination
+	Links           bool            `json:"links"`                 // Recreate symlinks as symlinks instead of copying their targets
+	CopyLinks       bool            `json:"copy_links"`            // Replace symlinks with the files and directories they point to
+	SafeLinks       bool            `json:"safe_links"`            // With Links, skip symlinks pointing outside the tree
+	RewriteLinks    bool            `json:"rewrite_links"`         // With Links, rewrite absolute symlinks into the tree as relative links
+	Delta           bool            `json:"delta"`                 // Update changed destination files with a rolling-checksum delta
+	DeltaBlockSize  int             `json:"delta_block_size"`      // Block size for delta signatures (0 = derive from file size)
+	Perms           bool            `json:"perms"`                 // Preserve permission bits, including setuid, setgid and sticky
+	Owner           bool            `json:"owner"`                 // Preserve file owners (requires root)
+	Group           bool            `json:"group"`                 // Preserve file groups
+	DirTimes        bool            `json:"dir_times"`             // Preserve directory modification times
+	NumericIDs      bool            `json:"numeric_ids"`           // Restore TAR ownership by uid/gid instead of user and group names
+	HardLinks       bool            `json:"hard_links"`            // Copy hard-linked files once and link their other names
+	Xattrs          bool            `json:"xattrs"`                // Preserve extended attributes
+	ACLs            bool            `json:"acls"`                  // Preserve POSIX ACLs
+	Sparse          bool            `json:"sparse"`                // Recreate holes of sparse files instead of writing zeros
+	Partial         bool            `json:"partial"`               // Keep partially transferred files and resume them on the next run
+	CacheDir        string          `json:"cache_dir"`             // Directory of per-tree checksum caches (empty = no cache)
+	Rehash          bool            `json:"rehash"`                // Ignore cached checksums and hash every file again
+	Verify          bool            `json:"verify"`                // Read back copied files and compare them to the source data
+	Report          bool            `json:"report"`                // Record the action taken for every file, for Syncer.Report
+	Itemize         bool            `json:"itemize"`               // Write a line with the changed attributes of every changed entry to Output
+	MaxErrors       int             `json:"max_errors"`            // Abort the sync once this many errors have occurred (0 = no limit)
+	BwLimit         int64           `json:"bw_limit"`              // Limit the data read by copies to this many bytes per second (0 = no limit)
+	BwSchedule      []BwLimitPeriod `json:"bw_schedule,omitempty"` // Daily limits that replace BwLimit, see ParseBwSchedule
+	FilesPerSecond  float64         `json:"files_per_second"`      // Limit the files written or deleted per second (0 = no limit)
+	WatchDebounce   time.Duration   `json:"watch_debounce"`        // With Watch, quiet time after a change before syncing it (0 = 2s)
+	WatchRescan     time.Duration   `json:"watch_rescan"`          // With Watch, interval of full syncs that catch missed changes (0 = none)
+	Logger          *slog.Logger    `json:"-"`                     // Receives progress, warnings and errors (nil = discarded)
+	Output          io.Writer       `json:"-"`                     // Receives the summary and itemized changes (nil = discarded)
+	Events          EventHandler    `json:"-"`                     // Receives the events of the sync (nil = none)
 	// TAR-specific options
-	TarCompress   bool   // Use gzip compression for TAR files
-	GPGEncrypt    bool   // Encrypt TAR files with GPG
-	GPGSign       bool   // Sign TAR files with GPG
-	GPGKeyID      string // GPG key ID for encryption/signing
-	GPGKeyring    string // Path to GPG keyring
+	TarCompress bool   `json:"tar_compress"` // Use gzip compression for TAR files
+	GPGEncrypt  bool   `json:"gpg_encrypt"`  // Encrypt TAR files with GPG
+	GPGSign     bool   `json:"gpg_sign"`     // Sign TAR files with GPG
+	GPGKeyID    string `json:"gpg_key_id"`   // GPG key ID for encryption/signing
+	GPGKeyring  string `json:"gpg_keyring"`  // Path to GPG keyring
 }
 
 // Syncer represents a file synchronizer
@@ -38,32 +75,75 @@ type Syncer struct {
 	options Options
 	stats   Stats
 	mu      sync.Mutex // For thread-safe stats updates
+	logger  *slog.Logger
+	// Progress of the running sync
+	progress progressTracker
+	// Report data
+	source    string
+	dest      string
+	startTime time.Time
+	endTime   time.Time
+	actions   []FileAction // Only recorded with Options.Report
+	failure   error        // Error that stopped the last sync, if any
+	nested    bool         // Set during the inner sync of a TAR to TAR sync
+	// Of the current or last sync, where stats add up over those of Watch
+	syncErrors         int
+	syncVerifyFailures int
+	// Shared by all workers, nil when not limited
+	bwLimiter   *rateLimiter
+	fileLimiter *rateLimiter
+	// Cancelled with the reason when the running sync is aborted
+	ctx    context.Context
+	cancel context.CancelCauseFunc
 }
 
 // Stats holds synchronization statistics
 type Stats struct {
-	FilesChecked int64
-	FilesCopied  int64
-	FilesDeleted int64
-	BytesCopied  int64
-	BytesDeleted int64
-	DirsCreated  int64
-	Errors       []string
+	FilesChecked int64    `json:"files_checked"`
+	FilesCopied  int64    `json:"files_copied"`
+	FilesDeleted int64    `json:"files_deleted"`
+	BytesCopied  int64    `json:"bytes_copied"`
+	BytesDeleted int64    `json:"bytes_deleted"`
+	DirsCreated  int64    `json:"dirs_created"`
+	Errors       []string `json:"-"` // Reported with their paths and classes in Report.Errors
+	// Errors with their paths and classes, verification failures included
+	FileErrors []ErrorRecord `json:"-"`
+	// Delta transfer stats
+	LiteralBytes int64 `json:"literal_bytes"` // Bytes written from source data that had no match
+	MatchedBytes int64 `json:"matched_bytes"` // Bytes reused from blocks already in the destination
+	ResumedBytes int64 `json:"resumed_bytes"` // Bytes reused from partial files of interrupted transfers
+	CacheHits    int64 `json:"cache_hits"`    // Checksums taken from the checksum cache instead of hashing
+	// Files whose permissions or ownership were fixed without copying
+	MetadataUpdated int64 `json:"metadata_updated"`
+	// Post-copy verification stats
+	FilesVerified  int64    `json:"files_verified"`
+	VerifyFailures []string `json:"verify_failures"` // Files that still differed from the source after every retry
 	// Preview-specific stats
-	FilesToCopy   int64
-	FilesToDelete int64
-	BytesToCopy   int64
-	BytesToDelete int64
-	DirsToCreate  int64
+	FilesToCopy      int64 `json:"files_to_copy"`
+	FilesToDelete    int64 `json:"files_to_delete"`
+	BytesToCopy      int64 `json:"bytes_to_copy"`
+	BytesToDelete    int64 `json:"bytes_to_delete"`
+	DirsToCreate     int64 `json:"dirs_to_create"`
+	MetadataToUpdate int64 `json:"metadata_to_update"`
 }
 
 // FileInfo represents file information for comparison
 type FileInfo struct {
-	Path     string
-	Size     int64
-	ModTime  time.Time
-	Checksum string
-	IsDir    bool
+	Path         string
+	Size         int64
+	ModTime      time.Time
+	Checksum     string
+	ChecksumAlgo string // Algorithm Checksum was calculated with
+	IsDir        bool
+	IsSymlink    bool              // Entry is a symlink preserved as a link
+	LinkTarget   string            // Target of the symlink when IsSymlink is set
+	Mode         os.FileMode       // File mode, including permission bits
+	Uid          int               // Numeric owner, -1 if unknown
+	Gid          int               // Numeric group, -1 if unknown
+	Device       uint64            // With HardLinks, device of a file with several names
+	Inode        uint64            // With HardLinks, inode of a file with several names
+	HardLink     string            // Path of the name this file is hard linked to
+	Xattrs       map[string][]byte // Preserved extended attributes and ACLs
 }
 
 // New creates a new Syncer with the given options
@@ -75,23 +155,78 @@ func New(options Options) *Syncer {
 	if options.Threads <= 0 {
 		options.Threads = 4
 	}
+	if options.ChecksumAlgo == "" {
+		options.ChecksumAlgo = DefaultChecksumAlgo
+	}
+	if options.Logger == nil {
+		options.Logger = slog.New(slog.DiscardHandler)
+	}
+	if options.Output == nil {
+		options.Output = io.Discard
+	}
 
+	ctx, cancel := context.WithCancelCause(context.Background())
 	return &Syncer{
 		options: options,
 		stats:   Stats{},
+		logger:  options.Logger,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 }
 
+// ErrTooManyErrors is returned by Sync when it was aborted after
+// Options.MaxErrors errors
+var ErrTooManyErrors = errors.New("too many errors")
+
 // Sync performs synchronization from source to destination
 func (s *Syncer) Sync(source, destination string) error {
-	if s.options.Verbose {
-		fmt.Printf("Starting sync from %s to %s\n", source, destination)
-		fmt.Printf("Method: %s, Threads: %d, DryRun: %t\n",
-			s.options.Method, s.options.Threads, s.options.DryRun)
+	return s.SyncContext(context.Background(), source, destination)
+}
+
+// SyncContext is like Sync, but stops when ctx is done. No new work is
+// started after that, copies in progress are abandoned, leaving the
+// destination files they would have replaced untouched (or, with Partial,
+// their partial files for the next run), and the summary of what was done
+// is written. It returns the cause of ctx.
+func (s *Syncer) SyncContext(ctx context.Context, source, destination string) error {
+	return s.syncContext(ctx, source, destination, nil)
+}
+
+// syncContext runs SyncContext over the paths of the trees in only,
+// relative to their roots, or over the whole trees if only is empty
+func (s *Syncer) syncContext(ctx context.Context, source, destination string, only []string) (err error) {
+	s.logger.Info("Starting sync", "source", source, "dest", destination,
+		"method", s.options.Method, "threads", s.options.Threads, "dry_run", s.options.DryRun)
+
+	if !ValidChecksumAlgo(s.options.ChecksumAlgo) {
+		return fmt.Errorf("unsupported checksum algorithm: %s", s.options.ChecksumAlgo)
 	}
 
 	startTime := time.Now()
 
+	// A TAR to TAR sync runs a nested sync of the extracted trees, which
+	// must not replace what the report says about the outer one
+	s.mu.Lock()
+	if !s.nested {
+		s.source, s.dest, s.startTime, s.endTime = source, destination, startTime, time.Time{}
+		s.syncErrors, s.syncVerifyFailures = 0, 0
+		s.progress.reset()
+		s.ctx, s.cancel = context.WithCancelCause(ctx)
+		s.bwLimiter, s.fileLimiter = s.newBwLimiter(), s.newFileLimiter()
+	}
+	s.mu.Unlock()
+	defer func() {
+		if s.nested {
+			return
+		}
+		s.cancel(nil)
+		s.mu.Lock()
+		s.endTime, s.failure = time.Now(), err
+		s.mu.Unlock()
+		s.emit(Event{Type: EventPhase, Phase: PhaseDone, Err: err})
+	}()
+
 	// Check if source or destination are TAR files
 	sourceTar := tar.IsTarFile(source)
 	destTar := tar.IsTarFile(destination)
@@ -101,213 +236,93 @@ func (s *Syncer) Sync(source, destination string) error {
 		return s.syncWithTar(source, destination, sourceTar, destTar)
 	}
 
-	// Build file maps for comparison
-	sourceFiles, err := s.buildFileMap(source, "")
-	if err != nil {
-		return fmt.Errorf("failed to scan source directory: %w", err)
-	}
-
-	var destFiles map[string]FileInfo
-	if _, err := os.Stat(destination); err == nil {
-		destFiles, err = s.buildFileMap(destination, "")
-		if err != nil {
-			return fmt.Errorf("failed to scan destination directory: %w", err)
-		}
-	} else {
-		destFiles = make(map[string]FileInfo)
+	_, statErr := os.Stat(destination)
+	destExists := statErr == nil
+	if !destExists && !s.options.DryRun {
 		// Create destination directory
-		if !s.options.DryRun {
-			if err := os.MkdirAll(destination, 0755); err != nil {
-				return fmt.Errorf("failed to create destination directory: %w", err)
-			}
+		if err := os.MkdirAll(destination, 0755); err != nil {
+			return fmt.Errorf("failed to create destination directory: %w", err)
 		}
 	}
 
-	// Process files with worker pool
-	if err := s.processFiles(source, destination, sourceFiles, destFiles); err != nil {
-		return err
-	}
-
-	// Handle file deletion if requested
-	if s.options.Delete {
-		if err := s.deleteExtraFiles(destination, sourceFiles, destFiles); err != nil {
-			return err
-		}
-	}
+	// Compare and sync both trees while they are being scanned
+	s.syncTrees(source, destination, destExists, only)
 
 	elapsed := time.Since(startTime)
-	if s.options.Verbose {
-		s.printStats(elapsed)
+	if s.options.Verbose && len(only) == 0 {
+		s.writeSummary(s.options.Output, elapsed)
 	}
 
-	return nil
-}
-
-// buildFileMap creates a map of files in the given directory
-func (s *Syncer) buildFileMap(root, relativeRoot string) (map[string]FileInfo, error) {
-	files := make(map[string]FileInfo)
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			s.addError(fmt.Sprintf("Error accessing %s: %v", path, err))
-			return nil // Continue walking
-		}
-
-		// Calculate relative path
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory itself
-		if relPath == "." {
-			return nil
-		}
-
-		// Skip subdirectories if not recursive
-		if !s.options.Recursive && info.IsDir() && filepath.Dir(relPath) != "." {
-			return filepath.SkipDir
-		}
-
-		fileInfo := FileInfo{
-			Path:    relPath,
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-		}
-
-		// Calculate checksum if needed and it's a regular file
-		if s.shouldCalculateChecksum() && !info.IsDir() {
-			// Check if it's a symlink and if it's accessible
-			if info.Mode()&os.ModeSymlink != 0 {
-				// For symlinks, check if target exists
-				if _, err := os.Stat(path); err != nil {
-					// Broken symlink - handle based on options
-					if s.options.SkipBrokenLinks {
-						if s.options.Verbose {
-							fmt.Printf("Skipping broken symlink: %s\n", path)
-						}
-						return nil // Skip this file entirely
-					} else {
-						// Just skip checksum calculation but include the file
-						if s.options.Verbose {
-							s.addError(fmt.Sprintf("Warning: broken symlink %s (target not found)", path))
-						}
-					}
-				} else {
-					// Valid symlink - calculate checksum
-					checksum, err := s.calculateChecksum(path)
-					if err != nil {
-						s.addError(fmt.Sprintf("Failed to calculate checksum for symlink %s: %v", path, err))
-					} else {
-						fileInfo.Checksum = checksum
-					}
-				}
-			} else {
-				// Regular file - calculate checksum
-				checksum, err := s.calculateChecksum(path)
-				if err != nil {
-					s.addError(fmt.Sprintf("Failed to calculate checksum for %s: %v", path, err))
-				} else {
-					fileInfo.Checksum = checksum
-				}
-			}
-		}
-
-		files[relPath] = fileInfo
-		s.incrementChecked()
-
-		return nil
-	})
-
-	return files, err
+	// A cancelled or aborted sync leaves the rest of the trees alone
+	return context.Cause(s.ctx)
 }
 
-// processFiles handles the actual file synchronization using worker pools
-func (s *Syncer) processFiles(source, dest string, sourceFiles, destFiles map[string]FileInfo) error {
-	// Create work queue
-	workChan := make(chan FileInfo, len(sourceFiles))
-	errorChan := make(chan error, len(sourceFiles))
-
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < s.options.Threads; i++ {
-		wg.Add(1)
-		go s.worker(source, dest, workChan, errorChan, &wg)
-	}
-
-	// Queue work items
-	go func() {
-		defer close(workChan)
-		for _, sourceFile := range sourceFiles {
-			if s.shouldSync(sourceFile, destFiles) {
-				workChan <- sourceFile
-			}
-		}
-	}()
-
-	// Wait for completion
-	go func() {
-		wg.Wait()
-		close(errorChan)
-	}()
-
-	// Collect errors
-	for err := range errorChan {
-		if err != nil {
-			s.addError(err.Error())
+// loadIgnoreFiles reads the per-directory ignore files of relDir
+func (s *Syncer) loadIgnoreFiles(matcher *filter.Matcher, relDir string) {
+	if err := matcher.EnterDir(relDir); err != nil {
+		path := relDir
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			path = pathErr.Path
 		}
+		s.addError(path, err)
 	}
-
-	return nil
 }
 
-// worker processes files from the work queue
-func (s *Syncer) worker(source, dest string, workChan <-chan FileInfo, errorChan chan<- error, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for fileInfo := range workChan {
-		sourcePath := filepath.Join(source, fileInfo.Path)
-		destPath := filepath.Join(dest, fileInfo.Path)
-
-		if err := s.syncFile(sourcePath, destPath, fileInfo); err != nil {
-			errorChan <- err
-		}
-	}
+// shouldSync determines if a file needs to be synchronized
+func (s *Syncer) shouldSync(sourceFile FileInfo, destFile *FileInfo) bool {
+	return s.syncReason(sourceFile, destFile) != ""
 }
 
-// shouldSync determines if a file needs to be synchronized
-func (s *Syncer) shouldSync(sourceFile FileInfo, destFiles map[string]FileInfo) bool {
-	destFile, exists := destFiles[sourceFile.Path]
+// syncReason returns why a file needs to be synchronized, or an empty
+// string if the destination is up to date
+func (s *Syncer) syncReason(sourceFile FileInfo, destFile *FileInfo) string {
+	if destFile == nil {
+		return "new" // File doesn't exist in destination
+	}
 
-	if !exists {
-		return true // File doesn't exist in destination
+	if sourceFile.IsDir != destFile.IsDir || sourceFile.IsSymlink != destFile.IsSymlink {
+		return "type changed" // Type mismatch (file vs directory vs symlink)
 	}
 
-	if sourceFile.IsDir != destFile.IsDir {
-		return true // Type mismatch (file vs directory)
+	if sourceFile.IsSymlink {
+		if sourceFile.LinkTarget != destFile.LinkTarget {
+			return "link target changed"
+		}
+		return ""
 	}
 
 	if sourceFile.IsDir {
-		return false // Directories don't need content sync
+		return "" // Directories don't need content sync
 	}
 
 	// Compare based on the selected method
 	switch s.options.Method {
 	case "size":
-		return sourceFile.Size != destFile.Size
+		if sourceFile.Size != destFile.Size {
+			return "size changed"
+		}
 	case "checksum":
-		return s.compareByChecksum(sourceFile, destFile)
+		if s.compareByChecksum(sourceFile, *destFile) {
+			return "content changed"
+		}
 	case "mtime":
 		fallthrough
 	default:
-		return sourceFile.ModTime.After(destFile.ModTime) || sourceFile.Size != destFile.Size
+		if sourceFile.Size != destFile.Size {
+			return "size changed"
+		}
+		if sourceFile.ModTime.After(destFile.ModTime) {
+			return "newer"
+		}
 	}
+	return ""
 }
 
 // compareByChecksum compares files by their checksums
 func (s *Syncer) compareByChecksum(sourceFile, destFile FileInfo) bool {
-	if sourceFile.Checksum != "" && destFile.Checksum != "" {
+	// Checksums of different algorithms say nothing about each other
+	if sourceFile.Checksum != "" && destFile.Checksum != "" && sourceFile.ChecksumAlgo == destFile.ChecksumAlgo {
 		return sourceFile.Checksum != destFile.Checksum
 	}
 	// If checksums aren't available, fall back to size + mtime
@@ -319,23 +334,26 @@ func (s *Syncer) syncFile(sourcePath, destPath string, fileInfo FileInfo) error
 	if fileInfo.IsDir {
 		return s.syncDirectory(destPath, fileInfo)
 	}
+	if fileInfo.IsSymlink {
+		return s.syncSymlink(destPath, fileInfo)
+	}
 	return s.syncRegularFile(sourcePath, destPath, fileInfo)
 }
 
 // syncDirectory creates a directory
 func (s *Syncer) syncDirectory(destPath string, fileInfo FileInfo) error {
-	if s.options.Verbose {
-		if s.options.DryRun {
-			fmt.Printf("Would create directory: %s\n", destPath)
-		} else {
-			fmt.Printf("Creating directory: %s\n", destPath)
-		}
-	}
+	s.logAction("Creating directory", "Would create directory", "path", destPath)
 
 	if s.options.DryRun {
 		s.incrementDirToCreate()
 	} else {
-		if err := os.MkdirAll(destPath, 0755); err != nil {
+		// Keep new directories writable by the owner until their contents
+		// are in place; the exact mode is applied at the end of the sync
+		perm := os.FileMode(0755)
+		if s.options.Perms {
+			perm = fileInfo.Mode.Perm() | 0700
+		}
+		if err := os.MkdirAll(destPath, perm); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", destPath, err)
 		}
 		s.incrementDirCreated()
@@ -346,13 +364,7 @@ func (s *Syncer) syncDirectory(destPath string, fileInfo FileInfo) error {
 
 // syncRegularFile copies a regular file
 func (s *Syncer) syncRegularFile(sourcePath, destPath string, fileInfo FileInfo) error {
-	if s.options.Verbose {
-		if s.options.DryRun {
-			fmt.Printf("Would copy: %s -> %s (%s)\n", sourcePath, destPath, utils.FormatBytes(fileInfo.Size))
-		} else {
-			fmt.Printf("Copying: %s -> %s (%s)\n", sourcePath, destPath, utils.FormatBytes(fileInfo.Size))
-		}
-	}
+	s.logAction("Copying", "Would copy", "source", sourcePath, "dest", destPath, "size", fileInfo.Size)
 
 	if s.options.DryRun {
 		s.incrementFileToCopy(fileInfo.Size)
@@ -370,109 +382,144 @@ func (s *Syncer) syncRegularFile(sourcePath, destPath string, fileInfo FileInfo)
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
-	// Copy file
-	if err := s.copyFile(sourcePath, destPath); err != nil {
+	// Take mode and ownership from the file that is read, which differs
+	// from the scanned entry when a symlink is copied as its target
+	fileInfo.Mode = sourceInfo.Mode()
+	fileInfo.Uid, fileInfo.Gid, _ = fileOwner(sourceInfo)
+
+	// Copy file, counting the bytes read for the progress display
+	active := s.progress.begin(fileInfo.Path, fileInfo.Size)
+	var tee io.Writer = io.MultiWriter(active, contextWriter{s.ctx})
+	if s.options.Events != nil {
+		s.emit(Event{Type: EventCopyStarted, Path: fileInfo.Path, Size: fileInfo.Size})
+		tee = io.MultiWriter(tee, &copyEvents{s: s, path: fileInfo.Path, size: fileInfo.Size})
+	}
+	if s.options.Verify {
+		err = s.copyVerified(sourcePath, destPath, fileInfo, tee)
+	} else {
+		err = s.copyFile(sourcePath, destPath, fileInfo, tee)
+	}
+	s.progress.end(active)
+	s.emit(Event{Type: EventCopyFinished, Path: fileInfo.Path, Size: fileInfo.Size, Done: active.done.Load(), Err: err})
+	if err != nil {
 		return fmt.Errorf("failed to copy file %s: %w", sourcePath, err)
 	}
 
 	// Preserve both access and modification times from source
 	if err := os.Chtimes(destPath, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
-		s.addError(fmt.Sprintf("Failed to preserve timestamps for %s: %v", destPath, err))
+		s.addError(destPath, fmt.Errorf("Failed to preserve timestamps for %s: %w", destPath, err))
 	}
 
 	s.incrementCopied(fileInfo.Size)
 	return nil
 }
 
-// copyFile performs the actual file copy
-func (s *Syncer) copyFile(src, dst string) error {
-	if s.options.Verbose {
-		fmt.Printf("  Opening source file: %s\n", src)
+// copyFile performs the actual file copy. If tee is not nil, the source data
+// is written to it as it is read.
+func (s *Syncer) copyFile(src, dst string, fileInfo FileInfo, tee io.Writer) error {
+	// An existing destination file is the basis of a delta transfer
+	var basisInfo os.FileInfo
+	if s.options.Delta {
+		if dstInfo, err := os.Stat(dst); err == nil && dstInfo.Mode().IsRegular() && dstInfo.Size() > 0 {
+			basisInfo = dstInfo
+		}
+	}
+
+	// An interrupted transfer is resumed in preference to a delta
+	if s.options.Partial {
+		if _, err := os.Stat(partialName(dst)); err == nil || basisInfo == nil {
+			return s.partialCopyFile(src, dst, fileInfo, tee)
+		}
+	}
+
+	if basisInfo != nil {
+		return s.deltaCopyFile(src, dst, basisInfo, fileInfo, tee)
 	}
-	
+
+	s.logger.Debug("Opening source file", "path", src)
+
 	source, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source file %s: %w", src, err)
 	}
 	defer source.Close()
 
-	if s.options.Verbose {
-		fmt.Printf("  Creating/overwriting destination file: %s\n", dst)
-	}
-	
-	destination, err := os.Create(dst)
+	// Write into a temporary file and rename it over the destination once
+	// complete, so the live destination is never left half-written
+	destination, err := createTempFile(dst)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file %s: %w", dst, err)
+		return fmt.Errorf("failed to create temporary file for %s: %w", dst, err)
 	}
-	defer destination.Close()
 
-	if s.options.Verbose {
-		fmt.Printf("  Copying data from source to destination...\n")
+	if err := s.setTempMetadata(destination, dst, fileInfo); err != nil {
+		discardTempFile(destination)
+		return err
+	}
+
+	s.logger.Debug("Writing to temporary file", "path", destination.Name())
+
+	var bytesWritten int64
+	if s.options.Sparse {
+		bytesWritten, err = s.copySparse(destination, source, tee)
+	} else {
+		bytesWritten, err = io.Copy(destination, teeReader(s.throttleReader(source), tee))
 	}
-	
-	bytesWritten, err := io.Copy(destination, source)
 	if err != nil {
+		discardTempFile(destination)
 		return fmt.Errorf("failed to copy data: %w", err)
 	}
-	
-	if s.options.Verbose {
-		fmt.Printf("  Successfully copied %d bytes\n", bytesWritten)
+
+	s.logger.Debug("Replacing destination file", "path", dst)
+
+	if err := commitTempFile(destination, dst); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Copied file", "path", dst, "bytes", bytesWritten)
+
+	if s.options.Delta {
+		s.incrementDelta(bytesWritten, 0)
 	}
-	
+
 	return nil
 }
 
-// deleteExtraFiles removes files from destination that don't exist in source
-func (s *Syncer) deleteExtraFiles(dest string, sourceFiles, destFiles map[string]FileInfo) error {
-	for relPath := range destFiles {
-		if _, exists := sourceFiles[relPath]; !exists {
-			fullPath := filepath.Join(dest, relPath)
-
-			info, err := os.Stat(fullPath)
-			if err != nil {
-				continue
-			}
-
-			if s.options.Verbose {
-				sizeStr := ""
-				if !info.IsDir() {
-					sizeStr = fmt.Sprintf(" (%s)", utils.FormatBytes(info.Size()))
-				}
-				if s.options.DryRun {
-					fmt.Printf("Would delete: %s%s\n", fullPath, sizeStr)
-				} else {
-					fmt.Printf("Deleting: %s%s\n", fullPath, sizeStr)
-				}
-			}
-
-			if s.options.DryRun {
-				if !info.IsDir() {
-					s.incrementFileToDelete(info.Size())
-				}
-			} else {
-				if err := os.RemoveAll(fullPath); err != nil {
-					s.addError(fmt.Sprintf("Failed to delete %s: %v", fullPath, err))
-					continue
-				}
-
-				if !info.IsDir() {
-					s.incrementDeleted(info.Size())
-				}
-			}
-		}
+// contextWriter fails writes once its context is done. Written to along
+// with the data of a copy, it abandons the copy when the sync is stopped.
+type contextWriter struct {
+	ctx context.Context
+}
+
+func (w contextWriter) Write(p []byte) (int, error) {
+	if w.ctx.Err() != nil {
+		return 0, context.Cause(w.ctx)
 	}
-	return nil
+	return len(p), nil
 }
 
-// calculateChecksum calculates SHA256 checksum of a file
+// teeReader returns r, writing everything read from it to w if w is not nil
+func teeReader(r io.Reader, w io.Writer) io.Reader {
+	if w == nil {
+		return r
+	}
+	return io.TeeReader(r, w)
+}
+
+// calculateChecksum calculates the checksum of a file with the configured
+// algorithm
 func (s *Syncer) calculateChecksum(path string) (string, error) {
+	newHash, ok := checksumAlgorithms[s.options.ChecksumAlgo]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm: %s", s.options.ChecksumAlgo)
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hasher := sha256.New()
+	hasher := newHash()
 	if _, err := io.Copy(hasher, file); err != nil {
 		return "", err
 	}
@@ -485,6 +532,15 @@ func (s *Syncer) shouldCalculateChecksum() bool {
 	return s.options.Method == "checksum" || s.options.Checksum
 }
 
+// logAction logs a change to the destination at info level, worded as a
+// plan when DryRun is set
+func (s *Syncer) logAction(msg, dryRunMsg string, args ...any) {
+	if s.options.DryRun {
+		msg = dryRunMsg
+	}
+	s.logger.Info(msg, args...)
+}
+
 // Thread-safe statistics methods
 func (s *Syncer) incrementChecked() {
 	s.mu.Lock()
@@ -506,12 +562,64 @@ func (s *Syncer) incrementDeleted(bytes int64) {
 	s.mu.Unlock()
 }
 
-func (s *Syncer) addError(err string) {
+func (s *Syncer) incrementDelta(literal, matched int64) {
+	s.mu.Lock()
+	s.stats.LiteralBytes += literal
+	s.stats.MatchedBytes += matched
+	s.mu.Unlock()
+}
+
+func (s *Syncer) addError(path string, err error) {
+	s.mu.Lock()
+	s.stats.Errors = append(s.stats.Errors, err.Error())
+	s.syncErrors++
+	s.recordErrorLocked(path, err)
+	s.mu.Unlock()
+	s.logger.Error(err.Error(), "path", path)
+	s.emit(Event{Type: EventError, Path: path, Err: err})
+}
+
+func (s *Syncer) incrementVerified() {
 	s.mu.Lock()
-	s.stats.Errors = append(s.stats.Errors, err)
+	s.stats.FilesVerified++
 	s.mu.Unlock()
 }
 
+func (s *Syncer) addVerifyFailure(path string, err error) {
+	s.mu.Lock()
+	s.stats.VerifyFailures = append(s.stats.VerifyFailures, err.Error())
+	s.syncVerifyFailures++
+	s.recordErrorLocked(path, err)
+	s.mu.Unlock()
+	s.emit(Event{Type: EventError, Path: path, Err: err})
+}
+
+// recordErrorLocked adds an error to stats.FileErrors and aborts the sync
+// once MaxErrors have occurred in it. s.mu must be held.
+func (s *Syncer) recordErrorLocked(path string, err error) {
+	s.stats.FileErrors = append(s.stats.FileErrors, ErrorRecord{Path: path, Class: errorClass(err), Message: err.Error(), Err: err})
+	if limit := s.options.MaxErrors; limit > 0 && s.syncErrors+s.syncVerifyFailures >= limit {
+		s.cancel(fmt.Errorf("%w: limit of %d reached", ErrTooManyErrors, limit))
+	}
+}
+
+// Stats returns the statistics of the current or last sync. It is safe to
+// call while Sync is running.
+func (s *Syncer) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statsLocked()
+}
+
+// statsLocked returns a copy of the statistics. s.mu must be held.
+func (s *Syncer) statsLocked() Stats {
+	stats := s.stats
+	stats.Errors = append([]string(nil), s.stats.Errors...)
+	stats.FileErrors = append([]ErrorRecord(nil), s.stats.FileErrors...)
+	stats.VerifyFailures = append([]string(nil), s.stats.VerifyFailures...)
+	return stats
+}
+
 func (s *Syncer) incrementDirCreated() {
 	s.mu.Lock()
 	s.stats.DirsCreated++
@@ -538,54 +646,82 @@ func (s *Syncer) incrementFileToDelete(bytes int64) {
 	s.mu.Unlock()
 }
 
-// printStats prints synchronization statistics
-func (s *Syncer) printStats(elapsed time.Duration) {
+func (s *Syncer) incrementCacheHit() {
+	s.mu.Lock()
+	s.stats.CacheHits++
+	s.mu.Unlock()
+}
+
+func (s *Syncer) incrementResumed(bytes int64) {
+	s.mu.Lock()
+	s.stats.ResumedBytes += bytes
+	s.mu.Unlock()
+}
+
+func (s *Syncer) incrementMetadataUpdated() {
+	s.mu.Lock()
+	s.stats.MetadataUpdated++
+	s.mu.Unlock()
+}
+
+func (s *Syncer) incrementMetadataToUpdate() {
+	s.mu.Lock()
+	s.stats.MetadataToUpdate++
+	s.mu.Unlock()
+}
+
+// writeSummary writes synchronization statistics to w
+func (s *Syncer) writeSummary(w io.Writer, elapsed time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.options.DryRun {
-		s.printPreviewSummary(elapsed)
+		s.writePreviewSummary(w, elapsed)
 	} else {
-		s.printExecutionSummary(elapsed)
+		s.writeExecutionSummary(w, elapsed)
 	}
 }
 
-// printPreviewSummary prints a comprehensive preview of planned operations
-func (s *Syncer) printPreviewSummary(elapsed time.Duration) {
-	fmt.Printf("\n%s\n", strings.Repeat("=", 60))
-	fmt.Printf("                    SYNC PREVIEW SUMMARY\n")
-	fmt.Printf("%s\n", strings.Repeat("=", 60))
+// writePreviewSummary writes a comprehensive preview of planned operations
+func (s *Syncer) writePreviewSummary(w io.Writer, elapsed time.Duration) {
+	fmt.Fprintf(w, "\n%s\n", strings.Repeat("=", 60))
+	fmt.Fprintf(w, "                    SYNC PREVIEW SUMMARY\n")
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", 60))
 
-	totalOperations := s.stats.FilesToCopy + s.stats.FilesToDelete + s.stats.DirsToCreate
+	totalOperations := s.stats.FilesToCopy + s.stats.FilesToDelete + s.stats.DirsToCreate + s.stats.MetadataToUpdate
 
 	if totalOperations == 0 {
-		fmt.Printf("* No changes needed - source and destination are in sync\n")
-		fmt.Printf("  Files checked: %d\n", s.stats.FilesChecked)
-		fmt.Printf("  Analysis time: %s\n", utils.FormatDuration(elapsed.Seconds()))
+		fmt.Fprintf(w, "* No changes needed - source and destination are in sync\n")
+		fmt.Fprintf(w, "  Files checked: %d\n", s.stats.FilesChecked)
+		fmt.Fprintf(w, "  Analysis time: %s\n", utils.FormatDuration(elapsed.Seconds()))
 		return
 	}
 
-	fmt.Printf("PLANNED OPERATIONS:\n")
-	fmt.Printf("%s\n", strings.Repeat("-", 30))
+	fmt.Fprintf(w, "PLANNED OPERATIONS:\n")
+	fmt.Fprintf(w, "%s\n", strings.Repeat("-", 30))
 
 	if s.stats.FilesToCopy > 0 {
-		fmt.Printf("Files to copy:      %d (%s)\n", s.stats.FilesToCopy, utils.FormatBytes(s.stats.BytesToCopy))
+		fmt.Fprintf(w, "Files to copy:      %d (%s)\n", s.stats.FilesToCopy, utils.FormatBytes(s.stats.BytesToCopy))
 	}
 
 	if s.stats.DirsToCreate > 0 {
-		fmt.Printf("Directories to create: %d\n", s.stats.DirsToCreate)
+		fmt.Fprintf(w, "Directories to create: %d\n", s.stats.DirsToCreate)
 	}
 
 	if s.stats.FilesToDelete > 0 {
-		fmt.Printf("Files to delete:    %d (%s)\n", s.stats.FilesToDelete, utils.FormatBytes(s.stats.BytesToDelete))
+		fmt.Fprintf(w, "Files to delete:    %d (%s)\n", s.stats.FilesToDelete, utils.FormatBytes(s.stats.BytesToDelete))
 	}
 
-	fmt.Printf("%s\n", strings.Repeat("-", 30))
-	fmt.Printf("SUMMARY:\n")
-	fmt.Printf("   Total operations:   %d\n", totalOperations)
-	fmt.Printf("   Files checked:      %d\n", s.stats.FilesChecked)
-	fmt.Printf("   Net data transfer:  %s\n", utils.FormatBytes(s.stats.BytesToCopy-s.stats.BytesToDelete))
-	fmt.Printf("   Analysis time:      %s\n", utils.FormatDuration(elapsed.Seconds()))
+	if s.stats.MetadataToUpdate > 0 {
+		fmt.Fprintf(w, "Attributes to update: %d\n", s.stats.MetadataToUpdate)
+	}
+
+	fmt.Fprintf(w, "%s\n", strings.Repeat("-", 30))
+	fmt.Fprintf(w, "SUMMARY:\n")
+	fmt.Fprintf(w, "   Total operations:   %d\n", totalOperations)
+	fmt.Fprintf(w, "   Files checked:      %d\n", s.stats.FilesChecked)
+	fmt.Fprintf(w, "   Net data transfer:  %s\n", utils.FormatBytes(s.stats.BytesToCopy-s.stats.BytesToDelete))
+	fmt.Fprintf(w, "   Analysis time:      %s\n", utils.FormatDuration(elapsed.Seconds()))
 
 	if s.stats.BytesToCopy > 0 {
 		// Rough estimation: 50MB/s for typical operations
@@ -593,51 +729,86 @@ func (s *Syncer) printPreviewSummary(elapsed time.Duration) {
 		if estimatedSeconds < 1 {
 			estimatedSeconds = 1
 		}
-		fmt.Printf("   Estimated sync time: %s\n", utils.FormatDuration(estimatedSeconds))
+		fmt.Fprintf(w, "   Estimated sync time: %s\n", utils.FormatDuration(estimatedSeconds))
 	}
 
 	if len(s.stats.Errors) > 0 {
-		fmt.Printf("\nISSUES FOUND (%d):\n", len(s.stats.Errors))
+		fmt.Fprintf(w, "\nISSUES FOUND (%d):\n", len(s.stats.Errors))
 		for _, err := range s.stats.Errors {
-			fmt.Printf("   • %s\n", err)
+			fmt.Fprintf(w, "   • %s\n", err)
 		}
 	}
 
-	fmt.Printf("%s\n", strings.Repeat("=", 60))
-	fmt.Printf("To execute these changes, run the same command without --dry-run\n")
-	fmt.Printf("%s\n", strings.Repeat("=", 60))
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", 60))
+	fmt.Fprintf(w, "To execute these changes, run the same command without --dry-run\n")
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", 60))
 }
 
-// printExecutionSummary prints statistics for actual sync operations
-func (s *Syncer) printExecutionSummary(elapsed time.Duration) {
-	fmt.Printf("\n%s\n", strings.Repeat("=", 50))
-	fmt.Printf("            SYNCHRONIZATION COMPLETE\n")
-	fmt.Printf("%s\n", strings.Repeat("=", 50))
+// writeExecutionSummary writes statistics for actual sync operations
+func (s *Syncer) writeExecutionSummary(w io.Writer, elapsed time.Duration) {
+	fmt.Fprintf(w, "\n%s\n", strings.Repeat("=", 50))
+	fmt.Fprintf(w, "            SYNCHRONIZATION COMPLETE\n")
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", 50))
 
-	fmt.Printf("RESULTS:\n")
-	fmt.Printf("   Files checked:  %d\n", s.stats.FilesChecked)
-	fmt.Printf("   Files copied:   %d\n", s.stats.FilesCopied)
-	fmt.Printf("   Files deleted:  %d\n", s.stats.FilesDeleted)
-	fmt.Printf("   Dirs created:   %d\n", s.stats.DirsCreated)
-	fmt.Printf("   Bytes copied:   %s\n", utils.FormatBytes(s.stats.BytesCopied))
-	fmt.Printf("   Bytes deleted:  %s\n", utils.FormatBytes(s.stats.BytesDeleted))
-	fmt.Printf("   Time elapsed:   %s\n", utils.FormatDuration(elapsed.Seconds()))
+	fmt.Fprintf(w, "RESULTS:\n")
+	fmt.Fprintf(w, "   Files checked:  %d\n", s.stats.FilesChecked)
+	fmt.Fprintf(w, "   Files copied:   %d\n", s.stats.FilesCopied)
+	fmt.Fprintf(w, "   Files deleted:  %d\n", s.stats.FilesDeleted)
+	fmt.Fprintf(w, "   Dirs created:   %d\n", s.stats.DirsCreated)
+	if s.stats.MetadataUpdated > 0 {
+		fmt.Fprintf(w, "   Attrs updated:  %d\n", s.stats.MetadataUpdated)
+	}
+	fmt.Fprintf(w, "   Bytes copied:   %s\n", utils.FormatBytes(s.stats.BytesCopied))
+	fmt.Fprintf(w, "   Bytes deleted:  %s\n", utils.FormatBytes(s.stats.BytesDeleted))
+	fmt.Fprintf(w, "   Time elapsed:   %s\n", utils.FormatDuration(elapsed.Seconds()))
 
 	if s.stats.BytesCopied > 0 && elapsed.Seconds() > 0 {
 		throughput := float64(s.stats.BytesCopied) / elapsed.Seconds()
-		fmt.Printf("   Throughput:     %s/s\n", utils.FormatBytes(int64(throughput)))
+		fmt.Fprintf(w, "   Throughput:     %s/s\n", utils.FormatBytes(int64(throughput)))
+	}
+
+	if s.stats.CacheHits > 0 {
+		fmt.Fprintf(w, "   Cached sums:    %d\n", s.stats.CacheHits)
+	}
+
+	if s.stats.ResumedBytes > 0 {
+		fmt.Fprintf(w, "   Resumed data:   %s\n", utils.FormatBytes(s.stats.ResumedBytes))
+	}
+
+	if s.options.Delta {
+		fmt.Fprintf(w, "   Literal data:   %s\n", utils.FormatBytes(s.stats.LiteralBytes))
+		fmt.Fprintf(w, "   Matched data:   %s\n", utils.FormatBytes(s.stats.MatchedBytes))
+		if total := s.stats.LiteralBytes + s.stats.MatchedBytes; total > 0 {
+			fmt.Fprintf(w, "   Delta savings:  %.1f%%\n", float64(s.stats.MatchedBytes)*100/float64(total))
+		}
+	}
+
+	if s.options.Verify {
+		fmt.Fprintf(w, "   Verified:       %d\n", s.stats.FilesVerified)
+	}
+
+	if len(s.stats.VerifyFailures) > 0 {
+		fmt.Fprintf(w, "\nVERIFICATION FAILURES (%d):\n", len(s.stats.VerifyFailures))
+		for _, failure := range s.stats.VerifyFailures {
+			fmt.Fprintf(w, "   • %s\n", failure)
+		}
 	}
 
 	if len(s.stats.Errors) > 0 {
-		fmt.Printf("\nERRORS (%d):\n", len(s.stats.Errors))
+		fmt.Fprintf(w, "\nERRORS (%d):\n", len(s.stats.Errors))
 		for _, err := range s.stats.Errors {
-			fmt.Printf("   • %s\n", err)
+			fmt.Fprintf(w, "   • %s\n", err)
 		}
-	} else {
-		fmt.Printf("\nSynchronization completed successfully!\n")
 	}
 
-	fmt.Printf("%s\n", strings.Repeat("=", 50))
+	switch {
+	case s.ctx.Err() != nil:
+		fmt.Fprintf(w, "\nSynchronization stopped early: %v\n", context.Cause(s.ctx))
+	case len(s.stats.Errors) == 0 && len(s.stats.VerifyFailures) == 0:
+		fmt.Fprintf(w, "\nSynchronization completed successfully!\n")
+	}
+
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", 50))
 }
 
 // syncWithTar handles synchronization involving TAR files
@@ -659,18 +830,25 @@ func (s *Syncer) syncWithTar(source, destination string, sourceTar, destTar bool
 
 // extractTarToDirectory extracts a TAR archive to a directory
 func (s *Syncer) extractTarToDirectory(tarPath, destDir string) error {
-	if s.options.Verbose {
-		fmt.Printf("Extracting TAR archive %s to directory %s\n", tarPath, destDir)
-	}
+	s.logAction("Extracting TAR archive", "Would extract TAR archive", "archive", tarPath, "dest", destDir)
+	s.emitPhase(PhaseExtract)
 
 	if s.options.DryRun {
-		fmt.Printf("Would extract TAR archive: %s -> %s\n", tarPath, destDir)
 		return nil
 	}
 
 	// Parse TAR options from file extension
 	tarOptions := tar.ParseTarOptions(tarPath)
-	tarOptions.Verbose = s.options.Verbose
+	tarOptions.Logger = s.logger
+	tarOptions.Links = s.options.Links
+	tarOptions.SafeLinks = s.options.SafeLinks
+	tarOptions.Perms = s.options.Perms
+	tarOptions.Owner = s.options.Owner
+	tarOptions.Group = s.options.Group
+	tarOptions.NumericIDs = s.options.NumericIDs
+	tarOptions.Xattrs = s.options.Xattrs
+	tarOptions.ACLs = s.options.ACLs
+	tarOptions.Sparse = s.options.Sparse
 	tarOptions.GPGKeyID = s.options.GPGKeyID
 	tarOptions.GPGKeyring = s.options.GPGKeyring
 
@@ -691,23 +869,28 @@ func (s *Syncer) extractTarToDirectory(tarPath, destDir string) error {
 
 // createTarFromDirectory creates a TAR archive from a directory
 func (s *Syncer) createTarFromDirectory(sourceDir, tarPath string) error {
-	if s.options.Verbose {
-		fmt.Printf("Creating TAR archive %s from directory %s\n", tarPath, sourceDir)
-	}
+	s.logAction("Creating TAR archive", "Would create TAR archive", "archive", tarPath, "source", sourceDir)
+	s.emitPhase(PhaseArchive)
 
 	if s.options.DryRun {
-		fmt.Printf("Would create TAR archive: %s -> %s\n", sourceDir, tarPath)
 		return nil
 	}
 
 	// Build TAR options
 	tarOptions := tar.TarOptions{
+		Filter:      s.options.Filter,
+		Links:       s.options.Links && !s.options.CopyLinks,
+		SafeLinks:   s.options.SafeLinks,
+		HardLinks:   s.options.HardLinks,
+		Xattrs:      s.options.Xattrs,
+		ACLs:        s.options.ACLs,
+		Sparse:      s.options.Sparse,
 		Compression: s.options.TarCompress,
 		GPGEncrypt:  s.options.GPGEncrypt,
 		GPGSign:     s.options.GPGSign,
 		GPGKeyID:    s.options.GPGKeyID,
 		GPGKeyring:  s.options.GPGKeyring,
-		Verbose:     s.options.Verbose,
+		Logger:      s.logger,
 	}
 
 	// Override with parsed options if needed
@@ -731,9 +914,7 @@ func (s *Syncer) createTarFromDirectory(sourceDir, tarPath string) error {
 
 // syncTarToTar synchronizes between two TAR archives
 func (s *Syncer) syncTarToTar(sourceTar, destTar string) error {
-	if s.options.Verbose {
-		fmt.Printf("Synchronizing TAR archive %s to %s\n", sourceTar, destTar)
-	}
+	s.logger.Info("Synchronizing TAR archive", "source", sourceTar, "dest", destTar)
 
 	// Create temporary directories for extraction
 	tempDir, err := os.MkdirTemp("", "msync-tar-")
@@ -765,13 +946,14 @@ func (s *Syncer) syncTarToTar(sourceTar, destTar string) error {
 	// Perform regular directory sync
 	originalDryRun := s.options.DryRun
 	s.options.DryRun = false // We need actual sync for TAR creation
-	
+	s.nested = true
+
 	if err := s.Sync(sourceExtractDir, destExtractDir); err != nil {
-		s.options.DryRun = originalDryRun
+		s.options.DryRun, s.nested = originalDryRun, false
 		return fmt.Errorf("failed to sync extracted directories: %w", err)
 	}
-	
-	s.options.DryRun = originalDryRun
+
+	s.options.DryRun, s.nested = originalDryRun, false
 
 	// Create new destination TAR if not dry run
 	if !s.options.DryRun {
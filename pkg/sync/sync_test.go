@@ -1,10 +1,18 @@
 package sync
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/osmontero/msync/pkg/filter"
 )
 
 func TestNew(t *testing.T) {
@@ -62,32 +70,31 @@ func TestShouldSync(t *testing.T) {
 	}
 
 	// Test file doesn't exist in destination
-	destFiles := make(map[string]FileInfo)
-	if !syncer.shouldSync(sourceFile, destFiles) {
+	if !syncer.shouldSync(sourceFile, nil) {
 		t.Error("Should sync when file doesn't exist in destination")
 	}
 
 	// Test file exists but is older
-	destFiles["test.txt"] = FileInfo{
+	destFile := FileInfo{
 		Path:    "test.txt",
 		Size:    100,
 		ModTime: older,
 		IsDir:   false,
 	}
 
-	if !syncer.shouldSync(sourceFile, destFiles) {
+	if !syncer.shouldSync(sourceFile, &destFile) {
 		t.Error("Should sync when destination file is older")
 	}
 
 	// Test file exists and is newer
-	destFiles["test.txt"] = FileInfo{
+	destFile = FileInfo{
 		Path:    "test.txt",
 		Size:    100,
 		ModTime: now.Add(time.Hour),
 		IsDir:   false,
 	}
 
-	if syncer.shouldSync(sourceFile, destFiles) {
+	if syncer.shouldSync(sourceFile, &destFile) {
 		t.Error("Should not sync when destination file is newer")
 	}
 }
@@ -174,3 +181,264 @@ func TestDryRun(t *testing.T) {
 		t.Error("File should not exist after dry run")
 	}
 }
+
+func TestSyncWithFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	sourceFiles := []string{"main.py", "main.pyc", "node_modules/lib/index.js", "src/app.py"}
+	for _, name := range sourceFiles {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create source directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	destFiles := []string{"old.txt", "cache.pyc", "gone/stale.pyc", "gone/stale.txt"}
+	for _, name := range destFiles {
+		path := filepath.Join(destDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create destination directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create destination file: %v", err)
+		}
+	}
+
+	rules, err := filter.Parse([]string{"- node_modules/", "- *.pyc"})
+	if err != nil {
+		t.Fatalf("Failed to parse filter rules: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Delete: true, Filter: rules})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	expectExists := map[string]bool{
+		"main.py":                   true,
+		"src/app.py":                true,
+		"main.pyc":                  false, // Excluded from copy
+		"node_modules/lib/index.js": false, // Excluded directory
+		"old.txt":                   false, // Deleted as extraneous
+		"gone/stale.txt":            false, // Deleted as extraneous
+		"cache.pyc":                 true,  // Excluded, protected from delete
+		"gone/stale.pyc":            true,  // Excluded, keeps its directory
+	}
+	for name, want := range expectExists {
+		_, err := os.Stat(filepath.Join(destDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("Expected %s exists=%t, got %t", name, want, exists)
+		}
+	}
+
+	// With DeleteExcluded the protected files are removed as well
+	syncer = New(Options{Recursive: true, Delete: true, DeleteExcluded: true, Filter: rules})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	for _, name := range []string{"cache.pyc", "gone"} {
+		if _, err := os.Stat(filepath.Join(destDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted with DeleteExcluded", name)
+		}
+	}
+}
+
+func TestSyncDeletesDirectoriesWithoutExcludedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	// A stale partial file is not part of the tree, and does not keep its
+	// directory like an excluded file does
+	destFiles := []string{"kept/note.log", "kept/other.txt", "leftover/.big.bin.msync-partial"}
+	for _, name := range destFiles {
+		path := filepath.Join(destDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create destination directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create destination file: %v", err)
+		}
+	}
+
+	// Like the command line, with an ignore file that matches nothing
+	rules, err := filter.Parse([]string{"- *.log"})
+	if err != nil {
+		t.Fatalf("Failed to parse filter rules: %v", err)
+	}
+	rules.AddIgnoreFile(".msyncignore")
+
+	// The dry run previews exactly what the real run does
+	var items [2]bytes.Buffer
+	for i, dryRun := range []bool{true, false} {
+		syncer := New(Options{Recursive: true, Delete: true, Filter: rules, DryRun: dryRun, Itemize: true, Output: &items[i]})
+		if err := syncer.Sync(sourceDir, destDir); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+	}
+	if items[0].String() != items[1].String() {
+		t.Errorf("Expected the dry run to itemize\n%s\nas the sync did, got\n%s", items[1].String(), items[0].String())
+	}
+
+	expectExists := map[string]bool{
+		"kept/note.log":  true,
+		"kept/other.txt": false,
+		"leftover":       false,
+	}
+	for name, want := range expectExists {
+		_, err := os.Stat(filepath.Join(destDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("Expected %s exists=%t, got %t", name, want, exists)
+		}
+	}
+}
+
+func TestSyncWithIgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	files := map[string]string{
+		".msyncignore":         "*.tmp\n",
+		"app/.gitignore":       "dist/\n!keep.tmp\n",
+		"app/main.go":          "package main",
+		"app/scratch.tmp":      "scratch",
+		"app/keep.tmp":         "keep",
+		"app/dist/bundle.js":   "bundle",
+		"other/dist/readme.md": "readme",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create source directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	rules := filter.New()
+	rules.AddIgnoreFile(".gitignore")
+	rules.AddIgnoreFile(".msyncignore")
+
+	syncer := New(Options{Recursive: true, Filter: rules})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	expectExists := map[string]bool{
+		".msyncignore":         true,
+		"app/.gitignore":       true,
+		"app/main.go":          true,
+		"app/keep.tmp":         true,  // Re-included by app/.gitignore
+		"app/scratch.tmp":      false, // Excluded by root .msyncignore
+		"app/dist":             false, // Excluded by app/.gitignore
+		"other/dist/readme.md": true,  // app/.gitignore does not apply here
+	}
+	for name, want := range expectExists {
+		_, err := os.Stat(filepath.Join(destDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("Expected %s exists=%t, got %t", name, want, exists)
+		}
+	}
+}
+
+func TestSyncLogsAndOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	var logs, output bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	syncer := New(Options{Recursive: true, Verbose: true, Logger: logger, Output: &output})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	var copied bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Log line is not JSON: %q", line)
+		}
+		if record["level"] == "DEBUG" {
+			t.Errorf("Unexpected debug record at info level: %v", record)
+		}
+		if record["msg"] == "Copying" && record["dest"] == filepath.Join(destDir, "file.txt") {
+			copied = true
+		}
+	}
+	if !copied {
+		t.Errorf("Expected a Copying record, got %s", logs.String())
+	}
+
+	if !strings.Contains(output.String(), "SYNCHRONIZATION COMPLETE") {
+		t.Errorf("Expected the summary in Output, got %q", output.String())
+	}
+}
+
+func TestSyncContextCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	files := map[string][]byte{
+		"a.bin": bytes.Repeat([]byte("large "), 1<<20),
+		"b.txt": []byte("b"),
+		"c.txt": []byte("c"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Cancel in the middle of copying the first file
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := EventHandlerFunc(func(event Event) {
+		if event.Type == EventCopyProgress {
+			cancel()
+		}
+	})
+
+	var output bytes.Buffer
+	syncer := New(Options{Recursive: true, Threads: 1, Verbose: true, Output: &output, Events: handler})
+	err := syncer.SyncContext(ctx, sourceDir, destDir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination: %v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("Expected an untouched destination, found %s", entry.Name())
+	}
+	if errs := syncer.Stats().FileErrors; len(errs) != 0 {
+		t.Errorf("Expected the abandoned copy not to count as an error, got %v", errs)
+	}
+	if !strings.Contains(output.String(), "Synchronization stopped early: context canceled") {
+		t.Errorf("Expected a partial summary, got %q", output.String())
+	}
+}
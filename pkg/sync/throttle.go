@@ -0,0 +1,179 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// BwLimitPeriod is an entry of a daily bandwidth schedule: from Start, an
+// offset from local midnight, copies are limited to Limit bytes per second
+// until the next entry begins
+type BwLimitPeriod struct {
+	Start time.Duration `json:"start"`
+	Limit int64         `json:"limit"` // 0 = unlimited
+}
+
+// ParseBwSchedule parses a daily bandwidth schedule such as
+// "08:00=20M,19:00=0": 20 MiB/s from 08:00 and unlimited from 19:00 until
+// 08:00 the next day. Limits take the suffixes of utils.ParseBytes.
+func ParseBwSchedule(spec string) ([]BwLimitPeriod, error) {
+	var schedule []BwLimitPeriod
+	for _, entry := range strings.Split(spec, ",") {
+		clock, limitSpec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry %q, expected HH:MM=LIMIT", entry)
+		}
+		start, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+		}
+		limit, err := utils.ParseBytes(limitSpec)
+		if err != nil {
+			return nil, err
+		}
+		offset := time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+		schedule = append(schedule, BwLimitPeriod{Start: offset, Limit: limit})
+	}
+
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i].Start < schedule[j].Start })
+	for i := 1; i < len(schedule); i++ {
+		if schedule[i].Start == schedule[i-1].Start {
+			return nil, fmt.Errorf("schedule has two entries for %02d:%02d",
+				schedule[i].Start/time.Hour, schedule[i].Start%time.Hour/time.Minute)
+		}
+	}
+	return schedule, nil
+}
+
+// scheduledLimit returns the limit of a sorted schedule at now. Before the
+// first entry of the day, the last entry of the previous day applies.
+func scheduledLimit(schedule []BwLimitPeriod, now time.Time) int64 {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+
+	limit := schedule[len(schedule)-1].Limit
+	for _, period := range schedule {
+		if period.Start > offset {
+			break
+		}
+		limit = period.Limit
+	}
+	return limit
+}
+
+// rateLimiter is a token bucket shared by all workers. Waiters take tokens
+// in advance and sleep until the bucket has refilled to cover them, so a
+// large request delays the requests after it rather than starving.
+type rateLimiter struct {
+	limit    func(now time.Time) float64 // Tokens per second at now, 0 = unlimited
+	mu       sync.Mutex
+	tokens   float64 // Negative while waiters owe tokens
+	last     time.Time
+	rate     float64 // Limit at last
+	maxBurst float64 // Seconds of tokens the bucket can hold
+}
+
+// newRateLimiter returns a limiter that allows limit(now) tokens per second
+func newRateLimiter(limit func(now time.Time) float64) *rateLimiter {
+	return &rateLimiter{limit: limit, maxBurst: 0.1}
+}
+
+// wait blocks until n tokens are available or ctx is done
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	l.mu.Lock()
+	now := time.Now()
+	if rate := l.limit(now); rate != l.rate || l.last.IsZero() {
+		// Start afresh with a full bucket when the limit changes
+		l.rate, l.tokens = rate, rate*l.maxBurst
+	} else {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate*l.maxBurst)
+	}
+	l.last = now
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// newBwLimiter returns the limiter of copy bandwidth, or nil if copies are
+// not limited
+func (s *Syncer) newBwLimiter() *rateLimiter {
+	schedule := append([]BwLimitPeriod(nil), s.options.BwSchedule...)
+	if len(schedule) > 0 {
+		sort.Slice(schedule, func(i, j int) bool { return schedule[i].Start < schedule[j].Start })
+		return newRateLimiter(func(now time.Time) float64 {
+			return float64(scheduledLimit(schedule, now))
+		})
+	}
+	if s.options.BwLimit > 0 {
+		return newRateLimiter(func(time.Time) float64 { return float64(s.options.BwLimit) })
+	}
+	return nil
+}
+
+// newFileLimiter returns the limiter of files written per second, or nil
+// if they are not limited
+func (s *Syncer) newFileLimiter() *rateLimiter {
+	if s.options.FilesPerSecond <= 0 {
+		return nil
+	}
+	limiter := newRateLimiter(func(time.Time) float64 { return s.options.FilesPerSecond })
+	// Let a single file through at once even below one file per second
+	limiter.maxBurst = max(limiter.maxBurst, 1/s.options.FilesPerSecond)
+	return limiter
+}
+
+// throttleFile waits until another file may be written under
+// Options.FilesPerSecond
+func (s *Syncer) throttleFile() error {
+	if s.fileLimiter == nil || s.options.DryRun {
+		return nil
+	}
+	return s.fileLimiter.wait(s.ctx, 1)
+}
+
+// throttleWriter waits for bandwidth for the data written to it. Written to
+// along with the data read from a source file, it limits the rate of copies.
+type throttleWriter struct {
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (w throttleWriter) Write(p []byte) (int, error) {
+	if err := w.limiter.wait(w.ctx, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// throttleReader returns r, limited to the copy bandwidth if there is a
+// limit. Only the data actually read from a source is throttled, not the
+// kept prefix of a partial file or the holes of a sparse one.
+func (s *Syncer) throttleReader(r io.Reader) io.Reader {
+	if s.bwLimiter == nil {
+		return r
+	}
+	return io.TeeReader(r, throttleWriter{s.ctx, s.bwLimiter})
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBwSchedule(t *testing.T) {
+	schedule, err := ParseBwSchedule("19:00=0, 08:00=20M")
+	if err != nil {
+		t.Fatalf("ParseBwSchedule failed: %v", err)
+	}
+	want := []BwLimitPeriod{{Start: 8 * time.Hour, Limit: 20 << 20}, {Start: 19 * time.Hour, Limit: 0}}
+	if len(schedule) != len(want) || schedule[0] != want[0] || schedule[1] != want[1] {
+		t.Errorf("ParseBwSchedule() = %v, want %v", schedule, want)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at   time.Duration
+		want int64
+	}{
+		{2 * time.Hour, 0}, // Still the evening entry of the day before
+		{8 * time.Hour, 20 << 20},
+		{12*time.Hour + 30*time.Minute, 20 << 20},
+		{19 * time.Hour, 0},
+		{23 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		if got := scheduledLimit(schedule, day.Add(tt.at)); got != tt.want {
+			t.Errorf("scheduledLimit at %v = %d, want %d", tt.at, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "08:00", "25:00=1M", "08:00=fast", "08:00=1M,08:00=2M"} {
+		if _, err := ParseBwSchedule(spec); err == nil {
+			t.Errorf("ParseBwSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestSyncBwLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	content := bytes.Repeat([]byte("x"), 1<<20)
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// 2 MiB at 8 MiB/s, shared by both workers, with a burst of 0.1s
+	syncer := New(Options{Recursive: true, Threads: 2, BwLimit: 8 << 20})
+	start := time.Now()
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the copies to take at least 150ms, took %v", elapsed)
+	}
+
+	for _, name := range []string{"a.bin", "b.bin"} {
+		copied, err := os.ReadFile(filepath.Join(destDir, name))
+		if err != nil || !bytes.Equal(copied, content) {
+			t.Errorf("Expected %s to be copied: %v", name, err)
+		}
+	}
+}
+
+func TestSyncBwLimitResumedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	for _, dir := range []string{sourceDir, destDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	content := bytes.Repeat([]byte("resumable content "), 1<<16) // ~1.1 MiB
+	if err := os.WriteFile(filepath.Join(sourceDir, "large.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	partialPath := partialName(filepath.Join(destDir, "large.bin"))
+	if err := os.WriteFile(partialPath, content[:len(content)-32<<10], 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+
+	// The kept prefix is not read for the copy, so only the rest is
+	// throttled at 256 KiB/s
+	syncer := New(Options{Recursive: true, Partial: true, BwLimit: 256 << 10})
+	start := time.Now()
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the kept prefix not to be throttled, took %v", elapsed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destDir, "large.bin"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Expected large.bin to be copied: %v", err)
+	}
+	if syncer.stats.ResumedBytes == 0 {
+		t.Error("Expected the partial file to be resumed")
+	}
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// verifyAttempts is how many times a file is copied before a verification
+// mismatch is reported
+const verifyAttempts = 3
+
+// errVerifyMismatch is returned when a written file does not read back as
+// the data that was copied into it
+var errVerifyMismatch = errors.New("destination content does not match source")
+
+// copyVerified copies src to dst and reads dst back to check it against the
+// hash of the source data taken during the copy, copying again on mismatch.
+// The source data is also written to tee if it is not nil, once however
+// many times it is copied, so that progress and events count it once.
+func (s *Syncer) copyVerified(src, dst string, fileInfo FileInfo, tee io.Writer) error {
+	newHash, ok := checksumAlgorithms[s.options.ChecksumAlgo]
+	if !ok {
+		return fmt.Errorf("unsupported checksum algorithm: %s", s.options.ChecksumAlgo)
+	}
+
+	var once *onceWriter
+	if tee != nil {
+		once = &onceWriter{w: tee}
+	}
+	for attempt := 1; ; attempt++ {
+		sum := newHash()
+		var w io.Writer = sum
+		if once != nil {
+			// A retry must still stop with the sync, before it gets past
+			// the data already passed on
+			once.offset = 0
+			w = io.MultiWriter(sum, once, contextWriter{s.ctx})
+		}
+		if err := s.copyFile(src, dst, fileInfo, w); err != nil {
+			return err
+		}
+
+		err := verifyFile(dst, sum.Sum(nil), newHash())
+		if err == nil {
+			s.incrementVerified()
+			return nil
+		}
+		if !errors.Is(err, errVerifyMismatch) {
+			return err
+		}
+		if attempt == verifyAttempts {
+			return fmt.Errorf("%w after %d attempts", err, verifyAttempts)
+		}
+
+		s.logger.Warn("Verification failed, copying again", "path", dst, "attempt", attempt+1, "attempts", verifyAttempts)
+	}
+}
+
+// onceWriter passes each offset of a stream on to w the first time it is
+// written, so that the data of a retried copy reaches w only once
+type onceWriter struct {
+	w       io.Writer
+	offset  int64 // Reached by the current attempt
+	written int64 // Passed on to w so far
+}
+
+func (o *onceWriter) Write(p []byte) (int, error) {
+	start := o.offset
+	o.offset += int64(len(p))
+	if o.offset > o.written {
+		if _, err := o.w.Write(p[max(o.written-start, 0):]); err != nil {
+			return 0, err
+		}
+		o.written = o.offset
+	}
+	return len(p), nil
+}
+
+// verifyFile hashes the content of path with hasher and compares it to
+// want. The cached pages of the file are dropped first, so that the data
+// is read from the device rather than from what was just written.
+func verifyFile(path string, want []byte, hasher hash.Hash) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for verification: %w", path, err)
+	}
+	defer file.Close()
+
+	utils.DropCache(file)
+
+	if _, err := io.Copy(hasher, file); err != nil {
+		return fmt.Errorf("failed to read %s for verification: %w", path, err)
+	}
+	if !bytes.Equal(hasher.Sum(nil), want) {
+		return errVerifyMismatch
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("verified content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	want := sha256.Sum256([]byte("verified content"))
+	if err := verifyFile(path, want[:], sha256.New()); err != nil {
+		t.Errorf("Expected matching file to verify, got %v", err)
+	}
+
+	other := sha256.Sum256([]byte("other content"))
+	if err := verifyFile(path, other[:], sha256.New()); !errors.Is(err, errVerifyMismatch) {
+		t.Errorf("Expected errVerifyMismatch, got %v", err)
+	}
+}
+
+func TestSyncVerify(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	files := map[string]string{
+		"a.txt": "first file",
+		"b.txt": "second file",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Each copy path hashes the source data it reads
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"plain", Options{}},
+		{"xxh64", Options{ChecksumAlgo: "xxh64"}},
+		{"sparse", Options{Sparse: true}},
+		{"partial", Options{Partial: true}},
+		{"delta", Options{Delta: true, Method: "size"}},
+	}
+
+	for _, tt := range tests {
+		dest := filepath.Join(destDir, tt.name)
+		if tt.options.Delta {
+			// Give the delta transfer existing files to work from
+			for name := range files {
+				if err := os.MkdirAll(dest, 0755); err != nil {
+					t.Fatalf("Failed to create destination directory: %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(dest, name), []byte("stale"), 0644); err != nil {
+					t.Fatalf("Failed to create destination %s: %v", name, err)
+				}
+			}
+		}
+
+		tt.options.Recursive = true
+		tt.options.Verify = true
+		syncer := New(tt.options)
+		if err := syncer.Sync(sourceDir, dest); err != nil {
+			t.Fatalf("%s: Sync failed: %v", tt.name, err)
+		}
+
+		if syncer.stats.FilesVerified != int64(len(files)) {
+			t.Errorf("%s: expected %d verified files, got %d", tt.name, len(files), syncer.stats.FilesVerified)
+		}
+		if len(syncer.stats.VerifyFailures) > 0 || len(syncer.stats.Errors) > 0 {
+			t.Errorf("%s: unexpected failures %v, errors %v", tt.name, syncer.stats.VerifyFailures, syncer.stats.Errors)
+		}
+	}
+}
+
+func TestSyncVerifyRetry(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	content := bytes.Repeat([]byte("retried "), 1<<18)
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// An algorithm whose second hash, the first read back, never matches
+	hashes := 0
+	checksumAlgorithms["flaky"] = func() hash.Hash {
+		hashes++
+		h := sha256.New()
+		if hashes == 2 {
+			h.Write([]byte("mismatch"))
+		}
+		return h
+	}
+	t.Cleanup(func() { delete(checksumAlgorithms, "flaky") })
+
+	var copied int64
+	handler := EventHandlerFunc(func(event Event) {
+		if event.Type == EventCopyFinished {
+			copied = event.Done
+		}
+	})
+	syncer := New(Options{Recursive: true, Verify: true, ChecksumAlgo: "flaky", Events: handler})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if hashes != 4 {
+		t.Errorf("Expected the file to be copied twice, got %d hashes", hashes)
+	}
+	if syncer.stats.FilesVerified != 1 || len(syncer.stats.VerifyFailures) > 0 {
+		t.Errorf("Expected the retry to verify, got %d verified, failures %v", syncer.stats.FilesVerified, syncer.stats.VerifyFailures)
+	}
+	size := int64(len(content))
+	if got := syncer.Progress().BytesTransferred; got != size {
+		t.Errorf("Expected %d bytes transferred, got %d", size, got)
+	}
+	if copied != size {
+		t.Errorf("Expected the copy to finish with %d bytes done, got %d", size, copied)
+	}
+}
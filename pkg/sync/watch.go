@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/osmontero/msync/pkg/tar"
+)
+
+const (
+	// defaultWatchDebounce is the quiet time after a change when
+	// Options.WatchDebounce is not set
+	defaultWatchDebounce = 2 * time.Second
+	// maxWatchDelay is how many debounce periods a change waits at most
+	// while the tree keeps changing
+	maxWatchDelay = 10
+	// maxWatchPaths is the number of changed paths above which a full sync
+	// is run instead, being cheaper than a scan limited to all of them
+	maxWatchPaths = 1000
+)
+
+// errWatchUnsupported is returned by newTreeWatcher on platforms where
+// changes to a tree cannot be watched
+var errWatchUnsupported = errors.New("watching for changes is not supported on this platform")
+
+// Watch syncs source to destination like SyncContext, then keeps watching
+// the source tree and syncs the paths that change once no more changes have
+// come for Options.WatchDebounce. A full sync runs every Options.WatchRescan
+// and whenever changes may have been missed. Statistics add up over all the
+// syncs. Watch returns the cause of ctx when it is done, or the error of a
+// sync that could not run.
+func (s *Syncer) Watch(ctx context.Context, source, destination string) error {
+	if tar.IsTarFile(source) || tar.IsTarFile(destination) {
+		return fmt.Errorf("watch mode does not support TAR archives")
+	}
+	debounce := s.options.WatchDebounce
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	// Start watching first, so that nothing changed during the first sync
+	// is missed
+	var changes <-chan string
+	watcher, err := newTreeWatcher(source, s.logger)
+	switch {
+	case err == nil:
+		defer watcher.close()
+		changes = watcher.changes
+	case errors.Is(err, errWatchUnsupported) && s.options.WatchRescan > 0:
+		s.logger.Warn("Changes cannot be watched, syncing periodically", "reason", err, "interval", s.options.WatchRescan)
+	default:
+		return fmt.Errorf("failed to watch %s: %w", source, err)
+	}
+
+	if err := s.SyncContext(ctx, source, destination); err != nil {
+		return err
+	}
+
+	var rescan <-chan time.Time
+	if s.options.WatchRescan > 0 {
+		ticker := time.NewTicker(s.options.WatchRescan)
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+
+	s.logger.Info("Watching for changes", "source", source, "debounce", debounce)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	var (
+		ready     <-chan time.Time // Fires when the pending changes are due
+		firstSeen time.Time        // When the oldest pending change came
+		changed   = make(map[string]bool)
+		full      bool // Sync everything rather than changed
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+
+		case relPath, ok := <-changes:
+			if !ok {
+				// The watcher only stops on its own when it failed
+				if rescan == nil {
+					return fmt.Errorf("stopped watching %s", source)
+				}
+				s.logger.Warn("Stopped watching for changes, syncing periodically", "interval", s.options.WatchRescan)
+				changes = nil
+				continue
+			}
+			if relPath == "" {
+				full = true
+			} else {
+				changed[relPath] = true
+			}
+			now := time.Now()
+			if ready == nil {
+				firstSeen = now
+			}
+			timer.Reset(min(debounce, firstSeen.Add(maxWatchDelay*debounce).Sub(now)))
+			ready = timer.C
+
+		case <-ready:
+			ready = nil
+			if err := s.syncChanges(ctx, source, destination, changed, full); err != nil {
+				return err
+			}
+			changed, full = make(map[string]bool), false
+
+		case <-rescan:
+			timer.Stop()
+			ready = nil
+			if err := s.syncChanges(ctx, source, destination, nil, true); err != nil {
+				return err
+			}
+			changed, full = make(map[string]bool), false
+		}
+	}
+}
+
+// syncChanges syncs the changed paths of source, relative to it, or the
+// whole tree if full is set or there are too many of them to be worth
+// limiting the scan to
+func (s *Syncer) syncChanges(ctx context.Context, source, destination string, changed map[string]bool, full bool) error {
+	paths := compactPaths(changed)
+	if full || len(paths) > maxWatchPaths {
+		s.logger.Info("Syncing the whole tree", "changed_paths", len(paths))
+		return s.SyncContext(ctx, source, destination)
+	}
+	s.logger.Info("Syncing changes", "changed_paths", len(paths))
+	return s.syncContext(ctx, source, destination, paths)
+}
+
+// compactPaths returns the sorted set of paths, leaving out those inside
+// another path of the set
+func compactPaths(set map[string]bool) []string {
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	compact := paths[:0]
+	for _, path := range paths {
+		inside := false
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			if set[dir] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			compact = append(compact, path)
+		}
+	}
+	return compact
+}
@@ -0,0 +1,199 @@
+//go:build linux
+
+package sync
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// watchMask selects the inotify events of a watched directory that change
+// what a sync would do
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_DONT_FOLLOW | syscall.IN_ONLYDIR | syscall.IN_EXCL_UNLINK
+
+// treeWatcher watches a directory tree with inotify, with a watch on every
+// directory of it. The paths of changed entries are sent to changes,
+// relative to the root; an empty path means that changes may have been
+// missed and the whole tree must be synced.
+type treeWatcher struct {
+	root    string
+	logger  *slog.Logger
+	fd      int
+	file    *os.File         // fd, read through the runtime poller so close interrupts reads
+	watches map[int32]string // Relative directories by watch descriptor, used by read only
+	changes chan string
+	done    chan struct{} // Closed by close
+	stopped chan struct{} // Closed when read returns
+}
+
+// newTreeWatcher starts watching the tree at root
+func newTreeWatcher(root string, logger *slog.Logger) (*treeWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &treeWatcher{
+		root:    root,
+		logger:  logger,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		changes: make(chan string, 1024),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := w.addTree(""); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.read()
+	return w, nil
+}
+
+// close stops watching
+func (w *treeWatcher) close() {
+	close(w.done)
+	w.file.Close()
+	<-w.stopped
+}
+
+// addTree watches relDir and the directories below it. Only a failure to
+// watch the root is returned; directories that cannot be watched are left
+// to the periodic full syncs.
+func (w *treeWatcher) addTree(relDir string) error {
+	top := filepath.Join(w.root, relDir)
+	return filepath.WalkDir(top, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			return nil
+		}
+		var wd int
+		if err == nil {
+			wd, err = syscall.InotifyAddWatch(w.fd, path, watchMask)
+			err = os.NewSyscallError("inotify_add_watch", err)
+		}
+		if err != nil {
+			if relDir == "" && path == top {
+				return err
+			}
+			if errors.Is(err, syscall.ENOSPC) {
+				w.logger.Warn("Too many directories to watch, raise fs.inotify.max_user_watches", "path", path)
+				return filepath.SkipAll
+			}
+			// Gone since it was created, or unreadable
+			w.logger.Debug("Cannot watch directory", "path", path, "error", err)
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(w.root, path)
+		if relPath == "." {
+			relPath = ""
+		}
+		w.watches[int32(wd)] = relPath
+		return nil
+	})
+}
+
+// removeTree drops the watches of relDir and the directories below it,
+// which have been moved away
+func (w *treeWatcher) removeTree(relDir string) {
+	for wd, dir := range w.watches {
+		if dir == relDir || strings.HasPrefix(dir, relDir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
+
+// read turns the events read from inotify into changed paths until the
+// watcher is closed
+func (w *treeWatcher) read() {
+	defer close(w.stopped)
+	defer close(w.changes)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.logger.Error("Failed to read file system events", "error", err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			// struct inotify_event: wd, mask, cookie, len, then the name
+			// padded with NULs to len
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			offset += syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[offset:offset+nameLen]), "\x00")
+			offset += nameLen
+
+			if !w.handle(wd, mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle sends the path changed by an event. It returns false once the
+// watcher is closed.
+func (w *treeWatcher) handle(wd int32, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.logger.Warn("Missed file system events, syncing the whole tree")
+		return w.send("")
+	}
+	dir, ok := w.watches[wd]
+	if !ok {
+		return true
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.watches, wd)
+		return true
+	}
+	if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+		// Reported by the parent directory, unless this is the root
+		if dir == "" {
+			return w.send("")
+		}
+		return true
+	}
+
+	// Without a name the event is about the watched directory itself, such
+	// as a change to its attributes. Syncs leave those of the root alone.
+	if name == "" && dir == "" {
+		return true
+	}
+
+	relPath := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 {
+		switch {
+		case mask&syscall.IN_MOVED_FROM != 0:
+			w.removeTree(relPath)
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			// Whatever is created in the directory before it is watched
+			// is synced along with it
+			w.addTree(relPath)
+		}
+	}
+	return w.send(relPath)
+}
+
+// send hands a changed path to the watcher's reader
+func (w *treeWatcher) send(relPath string) bool {
+	select {
+	case w.changes <- relPath:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	for _, name := range []string{"kept.txt", "changed.txt", "deleted.txt"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, "dir", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	syncer := New(Options{Recursive: true, Delete: true, Threads: 2, WatchDebounce: 50 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.Watch(ctx, sourceDir, destDir)
+	}()
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	hasContent := func(name, content string) func() bool {
+		return func() bool {
+			data, err := os.ReadFile(filepath.Join(destDir, name))
+			return err == nil && string(data) == content
+		}
+	}
+	waitFor("the first sync", hasContent(filepath.Join("dir", "deleted.txt"), "deleted.txt"))
+
+	// Changes, including a directory created after the watch began
+	if err := os.WriteFile(filepath.Join(sourceDir, "dir", "changed.txt"), []byte("new content"), 0644); err != nil {
+		t.Fatalf("Failed to change file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(sourceDir, "dir", "deleted.txt")); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(sourceDir, "new", "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "new", "sub", "file.txt"), []byte("file"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	waitFor("the changed file", hasContent(filepath.Join("dir", "changed.txt"), "new content"))
+	waitFor("the new file", hasContent(filepath.Join("new", "sub", "file.txt"), "file"))
+	waitFor("the deletion", func() bool {
+		_, err := os.Lstat(filepath.Join(destDir, "dir", "deleted.txt"))
+		return os.IsNotExist(err)
+	})
+
+	// Files in the new directory are watched too
+	if err := os.WriteFile(filepath.Join(sourceDir, "new", "sub", "file.txt"), []byte("changed again"), 0644); err != nil {
+		t.Fatalf("Failed to change file: %v", err)
+	}
+	waitFor("the file in the new directory", hasContent(filepath.Join("new", "sub", "file.txt"), "changed again"))
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if errs := syncer.Stats().FileErrors; len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestTreeWatcherDirectoryEvents(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	w, err := newTreeWatcher(root, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("Failed to watch %s: %v", root, err)
+	}
+	defer w.close()
+
+	// Events on the watched directories themselves come without a name,
+	// and must not be taken for missed changes
+	for _, dir := range []string{root, filepath.Join(root, "dir")} {
+		if err := os.Chmod(dir, 0700); err != nil {
+			t.Fatalf("Failed to change mode of %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "last.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	changed := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for !changed["last.txt"] {
+		select {
+		case relPath := <-w.changes:
+			if relPath == "" {
+				t.Fatal("Expected no full sync for changes to watched directories")
+			}
+			changed[relPath] = true
+		case <-timeout:
+			t.Fatalf("Timed out waiting for changes, got %v", changed)
+		}
+	}
+	if !changed["dir"] {
+		t.Errorf("Expected the change to dir to be reported, got %v", changed)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sync
+
+import "log/slog"
+
+// treeWatcher watches a directory tree for changes. Changes cannot be
+// watched on this platform.
+type treeWatcher struct {
+	changes chan string
+}
+
+func newTreeWatcher(root string, logger *slog.Logger) (*treeWatcher, error) {
+	return nil, errWatchUnsupported
+}
+
+func (w *treeWatcher) close() {}
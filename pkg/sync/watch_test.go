@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompactPaths(t *testing.T) {
+	set := map[string]bool{
+		"a":                          true,
+		filepath.Join("a", "b"):      true,
+		"a b":                        true,
+		filepath.Join("c", "d", "e"): true,
+		filepath.Join("c", "d"):      true,
+		filepath.Join("c", "de"):     true,
+		filepath.Join("f", "g", "h"): true,
+	}
+	want := []string{"a", "a b", filepath.Join("c", "d"), filepath.Join("c", "de"), filepath.Join("f", "g", "h")}
+	if got := compactPaths(set); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestSyncLimitedPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	files := map[string]string{
+		"top.txt":                         "top",
+		filepath.Join("a", "b", "1"):      "1",
+		filepath.Join("a", "b", "c", "2"): "2",
+		filepath.Join("a", "other"):       "other",
+		filepath.Join("z", "3"):           "3",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	// Extraneous files inside and outside the limit
+	for _, name := range []string{filepath.Join("a", "b", "extra"), filepath.Join("z", "extra")} {
+		path := filepath.Join(destDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("extra"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	syncer := New(Options{Recursive: true, Delete: true, Threads: 2})
+	if err := syncer.syncContext(context.Background(), sourceDir, destDir, []string{filepath.Join("a", "b")}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	for _, name := range []string{filepath.Join("a", "b", "1"), filepath.Join("a", "b", "c", "2"), filepath.Join("z", "extra")} {
+		if _, err := os.Stat(filepath.Join(destDir, name)); err != nil {
+			t.Errorf("Expected %s in the destination: %v", name, err)
+		}
+	}
+	for _, name := range []string{"top.txt", filepath.Join("a", "other"), filepath.Join("a", "b", "extra"), filepath.Join("z", "3")} {
+		if _, err := os.Lstat(filepath.Join(destDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s in the destination, got %v", name, err)
+		}
+	}
+}
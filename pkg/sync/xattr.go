@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// preserveXattrs reports whether extended attributes or ACLs are preserved
+func (s *Syncer) preserveXattrs() bool {
+	return s.options.Xattrs || s.options.ACLs
+}
+
+// setXattrs records the preserved extended attributes of a scanned entry.
+// Symlinks kept as links carry no attributes.
+func (s *Syncer) setXattrs(fileInfo *FileInfo, path string) {
+	if !s.preserveXattrs() || fileInfo.IsSymlink {
+		return
+	}
+
+	attrs, err := utils.Xattrs(path)
+	if err != nil {
+		s.addError(path, fmt.Errorf("Failed to read extended attributes for %s: %w", path, err))
+		return
+	}
+	fileInfo.Xattrs = utils.SelectXattrs(attrs, s.options.Xattrs, s.options.ACLs)
+}
+
+// xattrsDiffer reports whether two sets of extended attributes differ
+func xattrsDiffer(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || !bytes.Equal(value, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyXattrs makes the preserved extended attributes of path match those of
+// fileInfo, removing attributes the source does not have
+func (s *Syncer) applyXattrs(path string, fileInfo FileInfo) error {
+	if !s.preserveXattrs() || fileInfo.IsSymlink {
+		return nil
+	}
+
+	current, err := utils.Xattrs(path)
+	if err != nil {
+		return fmt.Errorf("failed to read extended attributes for %s: %w", path, err)
+	}
+	current = utils.SelectXattrs(current, s.options.Xattrs, s.options.ACLs)
+
+	for name, value := range fileInfo.Xattrs {
+		if old, ok := current[name]; ok && bytes.Equal(old, value) {
+			continue
+		}
+		if err := utils.SetXattr(path, name, value); err != nil {
+			return fmt.Errorf("failed to set extended attribute %s on %s: %w", name, path, err)
+		}
+	}
+
+	for name := range current {
+		if _, ok := fileInfo.Xattrs[name]; !ok {
+			if err := utils.RemoveXattr(path, name); err != nil {
+				return fmt.Errorf("failed to remove extended attribute %s from %s: %w", name, path, err)
+			}
+		}
+	}
+
+	return nil
+}
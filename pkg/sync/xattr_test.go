@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+func TestSyncPreservesXattrs(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	destDir := filepath.Join(tmpDir, "dest")
+
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	sourceFile := filepath.Join(sourceDir, "file.txt")
+	if err := os.WriteFile(sourceFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := utils.SetXattr(sourceFile, "user.msync.test", []byte("one")); err != nil {
+		t.Skipf("Extended attributes are not supported here: %v", err)
+	}
+	if err := utils.SetXattr(filepath.Join(sourceDir, "sub"), "user.msync.dir", []byte("sub")); err != nil {
+		t.Fatalf("Failed to set directory attribute: %v", err)
+	}
+
+	if err := New(Options{Recursive: true, Xattrs: true}).Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	attrs, err := utils.Xattrs(filepath.Join(destDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read destination attributes: %v", err)
+	}
+	if string(attrs["user.msync.test"]) != "one" {
+		t.Errorf("Expected user.msync.test=one, got %q", attrs["user.msync.test"])
+	}
+
+	// Attribute drift is repaired without copying the content again
+	if err := utils.SetXattr(sourceFile, "user.msync.test", []byte("two")); err != nil {
+		t.Fatalf("Failed to update attribute: %v", err)
+	}
+	if err := utils.SetXattr(filepath.Join(destDir, "file.txt"), "user.msync.stale", []byte("x")); err != nil {
+		t.Fatalf("Failed to add attribute: %v", err)
+	}
+
+	syncer := New(Options{Recursive: true, Xattrs: true})
+	if err := syncer.Sync(sourceDir, destDir); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if syncer.stats.FilesCopied != 0 || syncer.stats.MetadataUpdated != 1 {
+		t.Errorf("Expected 0 copies and 1 attribute update, got %d and %d",
+			syncer.stats.FilesCopied, syncer.stats.MetadataUpdated)
+	}
+
+	attrs, err = utils.Xattrs(filepath.Join(destDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read destination attributes: %v", err)
+	}
+	if string(attrs["user.msync.test"]) != "two" {
+		t.Errorf("Expected user.msync.test=two, got %q", attrs["user.msync.test"])
+	}
+	if _, ok := attrs["user.msync.stale"]; ok {
+		t.Error("Expected attribute missing from source to be removed")
+	}
+
+	attrs, err = utils.Xattrs(filepath.Join(destDir, "sub"))
+	if err != nil {
+		t.Fatalf("Failed to read directory attributes: %v", err)
+	}
+	if string(attrs["user.msync.dir"]) != "sub" {
+		t.Errorf("Expected directory attribute to be preserved, got %q", attrs["user.msync.dir"])
+	}
+}
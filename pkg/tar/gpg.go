@@ -2,12 +2,35 @@ package tar
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
 	"strings"
 )
 
+// ErrGPG is matched by errors.Is for the errors of every GPG operation
+var ErrGPG = errors.New("GPG operation failed")
+
+// gpgError is an error of a GPG operation. It has the message of err and
+// matches both err and ErrGPG.
+type gpgError struct {
+	err error
+}
+
+func (e *gpgError) Error() string {
+	return e.err.Error()
+}
+
+func (e *gpgError) Unwrap() []error {
+	return []error{e.err, ErrGPG}
+}
+
+// gpgErrorf formats an error of a GPG operation like fmt.Errorf
+func gpgErrorf(format string, args ...any) error {
+	return &gpgError{fmt.Errorf(format, args...)}
+}
+
 // GPGHandler handles GPG encryption, decryption, signing, and verification
 type GPGHandler struct {
 	KeyID       string
@@ -29,7 +52,7 @@ func NewGPGHandler(keyringPath, keyID string) (*GPGHandler, error) {
 	// Verify key exists if specified
 	if keyID != "" {
 		if err := handler.verifyKey(keyID); err != nil {
-			return nil, fmt.Errorf("GPG key verification failed: %w", err)
+			return nil, gpgErrorf("GPG key verification failed: %w", err)
 		}
 	}
 
@@ -40,7 +63,7 @@ func NewGPGHandler(keyringPath, keyID string) (*GPGHandler, error) {
 func (g *GPGHandler) checkGPGAvailable() error {
 	cmd := exec.Command("gpg", "--version")
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("GPG is not available: %w", err)
+		return gpgErrorf("GPG is not available: %w", err)
 	}
 	return nil
 }
@@ -54,7 +77,7 @@ func (g *GPGHandler) verifyKey(keyID string) error {
 
 	cmd := exec.Command("gpg", args...)
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("key %s not found", keyID)
+		return gpgErrorf("key %s not found", keyID)
 	}
 	return nil
 }
@@ -62,7 +85,7 @@ func (g *GPGHandler) verifyKey(keyID string) error {
 // Encrypt encrypts data using GPG and returns a WriteCloser
 func (g *GPGHandler) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	if g.KeyID == "" {
-		return nil, fmt.Errorf("no GPG key ID specified for encryption")
+		return nil, gpgErrorf("no GPG key ID specified for encryption")
 	}
 
 	args := []string{
@@ -83,12 +106,12 @@ func (g *GPGHandler) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+		return nil, gpgErrorf("failed to create stdin pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
 		stdin.Close()
-		return nil, fmt.Errorf("failed to start GPG encryption: %w", err)
+		return nil, gpgErrorf("failed to start GPG encryption: %w", err)
 	}
 
 	return &gpgWriter{
@@ -113,11 +136,11 @@ func (g *GPGHandler) Decrypt(reader io.Reader) (io.Reader, error) {
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, gpgErrorf("failed to create stdout pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start GPG decryption: %w", err)
+		return nil, gpgErrorf("failed to start GPG decryption: %w", err)
 	}
 
 	return &gpgReader{
@@ -129,7 +152,7 @@ func (g *GPGHandler) Decrypt(reader io.Reader) (io.Reader, error) {
 // Sign creates a detached GPG signature for a file
 func (g *GPGHandler) Sign(filePath, signaturePath string) error {
 	if g.KeyID == "" {
-		return fmt.Errorf("no GPG key ID specified for signing")
+		return gpgErrorf("no GPG key ID specified for signing")
 	}
 
 	args := []string{
@@ -147,7 +170,7 @@ func (g *GPGHandler) Sign(filePath, signaturePath string) error {
 	cmd := exec.Command("gpg", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("GPG signing failed: %w, output: %s", err, string(output))
+		return gpgErrorf("GPG signing failed: %w, output: %s", err, string(output))
 	}
 
 	return nil
@@ -168,7 +191,7 @@ func (g *GPGHandler) Verify(filePath, signaturePath string) error {
 	cmd := exec.Command("gpg", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("GPG signature verification failed: %w, output: %s", err, string(output))
+		return gpgErrorf("GPG signature verification failed: %w, output: %s", err, string(output))
 	}
 
 	return nil
@@ -199,7 +222,7 @@ func (g *GPGHandler) ListKeys() ([]string, error) {
 	cmd := exec.Command("gpg", args...)
 	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list GPG keys: %w", err)
+		return nil, gpgErrorf("failed to list GPG keys: %w", err)
 	}
 
 	var keys []string
@@ -228,9 +251,12 @@ func (w *gpgWriter) Write(p []byte) (n int, err error) {
 
 func (w *gpgWriter) Close() error {
 	if err := w.stdin.Close(); err != nil {
-		return err
+		return gpgErrorf("failed to finish GPG encryption: %w", err)
 	}
-	return w.cmd.Wait()
+	if err := w.cmd.Wait(); err != nil {
+		return gpgErrorf("GPG encryption failed: %w", err)
+	}
+	return nil
 }
 
 // gpgReader wraps a GPG decryption process
@@ -249,14 +275,14 @@ func (r *gpgReader) Read(p []byte) (n int, err error) {
 			if ok {
 				switch exitErr.ExitCode() {
 				case 2:
-					return n, fmt.Errorf("GPG decryption failed: file may not be encrypted or wrong key used (exit code 2)")
+					return n, gpgErrorf("GPG decryption failed: file may not be encrypted or wrong key used (exit code 2)")
 				case 9:
-					return n, fmt.Errorf("GPG decryption failed: no secret key available (exit code 9)")
+					return n, gpgErrorf("GPG decryption failed: no secret key available (exit code 9)")
 				default:
-					return n, fmt.Errorf("GPG process failed with exit code %d: %w", exitErr.ExitCode(), waitErr)
+					return n, gpgErrorf("GPG process failed with exit code %d: %w", exitErr.ExitCode(), waitErr)
 				}
 			}
-			return n, fmt.Errorf("GPG process failed: %w", waitErr)
+			return n, gpgErrorf("GPG process failed: %w", waitErr)
 		}
 	}
 	return n, err
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package tar
+
+// openNoFollow is not available on this platform, where extraction relies
+// on removing the existing entry first
+const openNoFollow = 0
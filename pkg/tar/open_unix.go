@@ -0,0 +1,8 @@
+//go:build unix
+
+package tar
+
+import "syscall"
+
+// openNoFollow makes opening a file fail if it is a symlink
+const openNoFollow = syscall.O_NOFOLLOW
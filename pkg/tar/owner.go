@@ -0,0 +1,61 @@
+package tar
+
+import (
+	"archive/tar"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// headerOwner returns the uid and gid to restore for an archive entry, using
+// -1 for ids that are not preserved. User and group names recorded in the
+// archive take precedence over the numeric ids unless NumericIDs is set.
+func (ta *TarArchive) headerOwner(header *tar.Header) (uid, gid int) {
+	uid, gid = -1, -1
+
+	// Changing the owner of a file requires super-user privileges
+	if ta.Options.Owner && os.Geteuid() == 0 {
+		uid = header.Uid
+		if !ta.Options.NumericIDs && header.Uname != "" {
+			if u, err := user.Lookup(header.Uname); err == nil {
+				if id, err := strconv.Atoi(u.Uid); err == nil {
+					uid = id
+				}
+			}
+		}
+	}
+
+	if ta.Options.Group {
+		gid = header.Gid
+		if !ta.Options.NumericIDs && header.Gname != "" {
+			if g, err := user.LookupGroup(header.Gname); err == nil {
+				if id, err := strconv.Atoi(g.Gid); err == nil {
+					gid = id
+				}
+			}
+		}
+	}
+
+	return uid, gid
+}
+
+// restoreMetadata applies the preserved ownership, permissions and extended
+// attributes of an archive entry to an extracted path
+func (ta *TarArchive) restoreMetadata(targetPath string, header *tar.Header) {
+	// Change ownership first, as chown clears the setuid and setgid bits
+	if uid, gid := ta.headerOwner(header); uid >= 0 || gid >= 0 {
+		if err := os.Lchown(targetPath, uid, gid); err != nil {
+			ta.logger().Warn("Failed to set ownership", "path", targetPath, "error", err)
+		}
+	}
+
+	if ta.Options.Perms && header.Typeflag != tar.TypeSymlink {
+		mode := header.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(targetPath, mode); err != nil {
+			ta.logger().Warn("Failed to set permissions", "path", targetPath, "error", err)
+		}
+	}
+
+	// ACLs go after the mode, as chmod rewrites the ACL mask
+	ta.restoreXattrs(targetPath, header)
+}
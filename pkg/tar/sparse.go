@@ -0,0 +1,188 @@
+package tar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// blockSize is the size of TAR header and padding blocks
+const blockSize = 512
+
+// writeSparseEntry stores a regular file with holes as a PAX 1.0 sparse
+// entry, the format GNU tar writes with --sparse. archive/tar can read these
+// entries but not write them, so the headers are encoded here and written to
+// out, the stream underneath tw. It returns false without writing anything
+// if the file has no holes.
+func (ta *TarArchive) writeSparseEntry(tw *tar.Writer, out io.Writer, header *tar.Header, filePath string) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	extents, err := utils.SparseExtents(file, header.Size)
+	if err != nil {
+		return false, fmt.Errorf("failed to map holes of %s: %w", filePath, err)
+	}
+	if !utils.HasHoles(extents, header.Size) {
+		return false, nil
+	}
+
+	ta.logger().Debug("Storing sparse file", "path", header.Name)
+
+	// GNU tar takes the file size from the end of the last extent, so a
+	// trailing hole is marked with an empty extent at the end of the file
+	if n := len(extents); n == 0 || extents[n-1].Offset+extents[n-1].Length < header.Size {
+		extents = append(extents, utils.Extent{Offset: header.Size})
+	}
+
+	// The sparse map is stored in front of the data, padded to a block
+	sparseMap := strconv.Itoa(len(extents)) + "\n"
+	var dataSize int64
+	for _, extent := range extents {
+		sparseMap += strconv.FormatInt(extent.Offset, 10) + "\n" + strconv.FormatInt(extent.Length, 10) + "\n"
+		dataSize += extent.Length
+	}
+	sparseMap += strings.Repeat("\x00", padding(int64(len(sparseMap))))
+	entrySize := int64(len(sparseMap)) + dataSize
+
+	records := map[string]string{
+		"GNU.sparse.major":    "1",
+		"GNU.sparse.minor":    "0",
+		"GNU.sparse.name":     header.Name,
+		"GNU.sparse.realsize": strconv.FormatInt(header.Size, 10),
+		"size":                strconv.FormatInt(entrySize, 10),
+		"mtime":               strconv.FormatInt(header.ModTime.Unix(), 10),
+		"uid":                 strconv.Itoa(header.Uid),
+		"gid":                 strconv.Itoa(header.Gid),
+	}
+	if header.Uname != "" {
+		records["uname"] = header.Uname
+	}
+	if header.Gname != "" {
+		records["gname"] = header.Gname
+	}
+	for key, value := range header.PAXRecords {
+		records[key] = value
+	}
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pax strings.Builder
+	for _, key := range keys {
+		pax.WriteString(paxRecord(key, records[key]))
+	}
+
+	dir, base := path.Split(header.Name)
+	sparseName := path.Join(dir, "GNUSparseFile.0", base)
+
+	// Finish the previous entry before writing around the tar.Writer
+	if err := tw.Flush(); err != nil {
+		return false, fmt.Errorf("failed to write header for %s: %w", filePath, err)
+	}
+
+	blocks := [][]byte{
+		ustarHeader(path.Join(dir, "PaxHeaders.0", base), tar.TypeXHeader, header, int64(pax.Len())),
+		padBlock([]byte(pax.String())),
+		ustarHeader(sparseName, tar.TypeReg, header, entrySize),
+		[]byte(sparseMap),
+	}
+	for _, block := range blocks {
+		if _, err := out.Write(block); err != nil {
+			return false, fmt.Errorf("failed to write header for %s: %w", filePath, err)
+		}
+	}
+
+	for _, extent := range extents {
+		if _, err := io.Copy(out, io.NewSectionReader(file, extent.Offset, extent.Length)); err != nil {
+			return false, fmt.Errorf("failed to write file content for %s: %w", filePath, err)
+		}
+	}
+	if _, err := out.Write(make([]byte, padding(dataSize))); err != nil {
+		return false, fmt.Errorf("failed to write file content for %s: %w", filePath, err)
+	}
+
+	return true, nil
+}
+
+// ustarHeader encodes a USTAR header block. Fields that do not fit are left
+// empty, as the PAX records in front of the block take precedence.
+func ustarHeader(name string, typeflag byte, header *tar.Header, size int64) []byte {
+	block := make([]byte, blockSize)
+
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	copy(block[0:100], name)
+	putOctal(block[100:108], int64(header.Mode&0o7777))
+	putOctal(block[108:116], int64(header.Uid))
+	putOctal(block[116:124], int64(header.Gid))
+	putOctal(block[124:136], size)
+	putOctal(block[136:148], header.ModTime.Unix())
+	block[156] = typeflag
+	copy(block[257:263], "ustar\x00")
+	copy(block[263:265], "00")
+	if len(header.Uname) <= 32 {
+		copy(block[265:297], header.Uname)
+	}
+	if len(header.Gname) <= 32 {
+		copy(block[297:329], header.Gname)
+	}
+
+	// The checksum is computed with the checksum field set to spaces
+	copy(block[148:156], "        ")
+	var sum int64
+	for _, b := range block {
+		sum += int64(b)
+	}
+	putOctal(block[148:156], sum)
+
+	return block
+}
+
+// putOctal writes v as a zero-padded, NUL-terminated octal number, leaving
+// the field empty if v does not fit
+func putOctal(field []byte, v int64) {
+	s := strconv.FormatInt(v, 8)
+	if v < 0 || len(s) > len(field)-1 {
+		return
+	}
+	copy(field, strings.Repeat("0", len(field)-1-len(s))+s)
+	field[len(field)-1] = 0
+}
+
+// paxRecord formats a PAX extended header record, whose length prefix
+// counts its own digits
+func paxRecord(key, value string) string {
+	const extra = len(" =\n")
+	size := len(key) + len(value) + extra
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	if len(record) != size {
+		// Adding the length prefix added a digit
+		size = len(record)
+		record = strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	}
+	return record
+}
+
+// padding returns the number of bytes that pad n to a full block
+func padding(n int64) int {
+	return int(-n & (blockSize - 1))
+}
+
+// padBlock pads data with zeros to a full block
+func padBlock(data []byte) []byte {
+	return append(data, make([]byte, padding(int64(len(data))))...)
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package tar
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestTarArchive_Sparse(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+
+	sourcePath := filepath.Join(sourceDir, "disk.img")
+	f, err := os.Create(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(4 << 20); err != nil {
+		t.Fatalf("Failed to size file: %v", err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte("data"), 2048), 1<<20); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	f.Close()
+
+	content, err := os.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "sparse.tar")
+	archive, err := New(archivePath, TarOptions{Sparse: true})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	// Only the data is stored in the archive
+	if info, err := os.Stat(archivePath); err != nil {
+		t.Fatalf("Failed to stat archive: %v", err)
+	} else if info.Size() >= int64(len(content)) {
+		t.Skipf("File system does not report holes, archive is %d bytes", info.Size())
+	}
+
+	entries, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "disk.img" || entries[0].Size != int64(len(content)) {
+		t.Fatalf("Expected disk.img of %d bytes, got %+v", len(content), entries)
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	extracted := filepath.Join(extractDir, "disk.img")
+	got, err := os.ReadFile(extracted)
+	if err != nil {
+		t.Fatalf("Failed to read extracted file: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("Extracted content differs from source")
+	}
+
+	info, err := os.Stat(extracted)
+	if err != nil {
+		t.Fatalf("Failed to stat extracted file: %v", err)
+	}
+	if used := info.Sys().(*syscall.Stat_t).Blocks * 512; used >= int64(len(content)) {
+		t.Errorf("Expected extracted file to be sparse, uses %d bytes", used)
+	}
+}
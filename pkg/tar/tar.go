@@ -5,20 +5,36 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/osmontero/msync/internal/utils"
+	"github.com/osmontero/msync/pkg/filter"
 )
 
 // TarOptions holds configuration for TAR operations
 type TarOptions struct {
-	Compression bool   // Use gzip compression
-	GPGEncrypt  bool   // Encrypt the TAR file with GPG
-	GPGSign     bool   // Sign the TAR file with GPG
-	GPGKeyID    string // GPG key ID for encryption/signing
-	GPGKeyring  string // Path to GPG keyring
-	Verbose     bool   // Verbose output
+	Compression bool           // Use gzip compression
+	GPGEncrypt  bool           // Encrypt the TAR file with GPG
+	GPGSign     bool           // Sign the TAR file with GPG
+	GPGKeyID    string         // GPG key ID for encryption/signing
+	GPGKeyring  string         // Path to GPG keyring
+	Verbose     bool           // Deprecated: progress is logged to Logger at info level
+	Logger      *slog.Logger   // Receives progress and warnings (nil = discarded)
+	Filter      *filter.Filter // Include/exclude rules and ignore files applied when creating archives
+	Links       bool           // Store symlinks as links instead of the files they point to, and extract them
+	SafeLinks   bool           // Skip symlinks pointing outside the tree
+	Perms       bool           // Restore exact permission bits on extraction
+	Owner       bool           // Restore file owners on extraction (requires root)
+	Group       bool           // Restore file groups on extraction
+	NumericIDs  bool           // Restore ownership by uid/gid instead of user and group names
+	HardLinks   bool           // Store extra names of hard-linked files as links
+	Xattrs      bool           // Store and restore extended attributes in PAX headers
+	ACLs        bool           // Store and restore POSIX ACLs in PAX headers
+	Sparse      bool           // Store holes of sparse files and recreate them on extraction
 }
 
 // TarArchive represents a TAR archive with optional encryption and signing
@@ -30,11 +46,12 @@ type TarArchive struct {
 
 // FileInfo represents a file in the TAR archive
 type TarFileInfo struct {
-	Name    string
-	Size    int64
-	ModTime time.Time
-	IsDir   bool
-	Mode    os.FileMode
+	Name       string
+	Size       int64
+	ModTime    time.Time
+	IsDir      bool
+	Mode       os.FileMode
+	LinkTarget string // Target of symlink and hard link entries
 }
 
 // New creates a new TarArchive instance
@@ -56,11 +73,18 @@ func New(path string, options TarOptions) (*TarArchive, error) {
 	return ta, nil
 }
 
+// logger returns the logger of the archive, which discards everything if
+// none was set
+func (ta *TarArchive) logger() *slog.Logger {
+	if ta.Options.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return ta.Options.Logger
+}
+
 // Create creates a TAR archive from the specified source directory
 func (ta *TarArchive) Create(sourceDir string) error {
-	if ta.Options.Verbose {
-		fmt.Printf("Creating TAR archive: %s from %s\n", ta.Path, sourceDir)
-	}
+	ta.logger().Info("Creating TAR archive", "archive", ta.Path, "source", sourceDir)
 
 	// Create the archive file
 	file, err := os.Create(ta.Path)
@@ -94,6 +118,9 @@ func (ta *TarArchive) Create(sourceDir string) error {
 	defer tarWriter.Close()
 
 	// Walk through source directory and add files to archive
+	matcher := ta.Options.Filter.Matcher(sourceDir)
+	// First archived name of each hard-linked file, by device and inode
+	linked := make(map[[2]uint64]string)
 	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -107,11 +134,48 @@ func (ta *TarArchive) Create(sourceDir string) error {
 
 		// Skip the root directory itself
 		if relPath == "." {
+			return matcher.EnterDir(relPath)
+		}
+
+		// Skip excluded paths, including everything below excluded directories
+		if matcher.Excluded(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
+		if info.IsDir() {
+			if err := matcher.EnterDir(relPath); err != nil {
+				return err
+			}
+		}
+
+		// Store symlinks as links, or archive what they point to
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if ta.Options.Links {
+				target, err := os.Readlink(path)
+				if err != nil {
+					return fmt.Errorf("failed to read symlink %s: %w", path, err)
+				}
+				if ta.Options.SafeLinks && utils.IsUnsafeLink(relPath, target) {
+					ta.logger().Info("Skipping unsafe symlink", "path", relPath, "target", target)
+					return nil
+				}
+				link = target
+			} else {
+				targetInfo, err := os.Stat(path)
+				if err != nil {
+					ta.logger().Warn("Skipping broken symlink", "path", path)
+					return nil
+				}
+				info = targetInfo
+			}
+		}
+
 		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return fmt.Errorf("failed to create header for %s: %w", path, err)
 		}
@@ -119,8 +183,32 @@ func (ta *TarArchive) Create(sourceDir string) error {
 		// Set the name to use forward slashes (TAR standard)
 		header.Name = filepath.ToSlash(relPath)
 
-		if ta.Options.Verbose {
-			fmt.Printf("Adding: %s\n", header.Name)
+		if err := ta.addXattrs(header, path); err != nil {
+			return err
+		}
+
+		// Later names of a hard-linked file refer back to the first one
+		// instead of storing its content again
+		if ta.Options.HardLinks && info.Mode().IsRegular() {
+			if dev, ino, nlink, ok := utils.FileID(info); ok && nlink > 1 {
+				key := [2]uint64{dev, ino}
+				if first, seen := linked[key]; seen {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = first
+					header.Size = 0
+				} else {
+					linked[key] = header.Name
+				}
+			}
+		}
+
+		ta.logger().Info("Adding", "path", header.Name)
+
+		if ta.Options.Sparse && header.Typeflag == tar.TypeReg {
+			stored, err := ta.writeSparseEntry(tarWriter, writer, header, path)
+			if err != nil || stored {
+				return err
+			}
 		}
 
 		// Write header
@@ -129,7 +217,7 @@ func (ta *TarArchive) Create(sourceDir string) error {
 		}
 
 		// Write file content if it's a regular file
-		if info.Mode().IsRegular() {
+		if header.Typeflag == tar.TypeReg {
 			file, err := os.Open(path)
 			if err != nil {
 				return fmt.Errorf("failed to open file %s: %w", path, err)
@@ -155,9 +243,7 @@ func (ta *TarArchive) Create(sourceDir string) error {
 		if err := ta.gpg.Sign(ta.Path, signaturePath); err != nil {
 			return fmt.Errorf("failed to create GPG signature: %w", err)
 		}
-		if ta.Options.Verbose {
-			fmt.Printf("Created GPG signature: %s\n", signaturePath)
-		}
+		ta.logger().Info("Created GPG signature", "path", signaturePath)
 	}
 
 	return nil
@@ -165,9 +251,7 @@ func (ta *TarArchive) Create(sourceDir string) error {
 
 // Extract extracts the TAR archive to the specified destination directory
 func (ta *TarArchive) Extract(destDir string) error {
-	if ta.Options.Verbose {
-		fmt.Printf("Extracting TAR archive: %s to %s\n", ta.Path, destDir)
-	}
+	ta.logger().Info("Extracting TAR archive", "archive", ta.Path, "dest", destDir)
 
 	// Verify GPG signature if signing was enabled
 	if ta.Options.GPGSign && ta.gpg != nil {
@@ -176,9 +260,7 @@ func (ta *TarArchive) Extract(destDir string) error {
 			if err := ta.gpg.Verify(ta.Path, signaturePath); err != nil {
 				return fmt.Errorf("GPG signature verification failed: %w", err)
 			}
-			if ta.Options.Verbose {
-				fmt.Printf("GPG signature verified successfully\n")
-			}
+			ta.logger().Info("GPG signature verified", "path", signaturePath)
 		}
 	}
 
@@ -206,12 +288,10 @@ func (ta *TarArchive) Extract(destDir string) error {
 		// Reset file position
 		file.Seek(0, 0)
 
-		if ta.Options.Verbose {
-			if actuallyEncrypted {
-				fmt.Printf("File is GPG encrypted, decrypting...\n")
-			} else {
-				fmt.Printf("File is not encrypted despite .gpg extension\n")
-			}
+		if actuallyEncrypted {
+			ta.logger().Debug("Decrypting GPG encrypted archive", "archive", ta.Path)
+		} else {
+			ta.logger().Warn("Archive is not encrypted despite .gpg extension", "archive", ta.Path)
 		}
 	}
 
@@ -236,6 +316,20 @@ func (ta *TarArchive) Extract(destDir string) error {
 
 	tarReader := tar.NewReader(reader)
 
+	// Entries are checked against the real destination, whatever links
+	// lead to it
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve destination directory: %w", err)
+	}
+
+	// Directory attributes are applied once extraction is complete, as
+	// creating entries inside a directory changes its modification time
+	var dirs []*tar.Header
+
 	// Extract files
 	for {
 		header, err := tarReader.Next()
@@ -247,19 +341,28 @@ func (ta *TarArchive) Extract(destDir string) error {
 		}
 
 		// Convert back to OS-specific path
-		targetPath := filepath.Join(destDir, filepath.FromSlash(header.Name))
-
-		if ta.Options.Verbose {
-			fmt.Printf("Extracting: %s\n", header.Name)
+		targetPath, err := entryPath(root, header.Name)
+		if err != nil {
+			ta.logger().Warn("Skipping unsafe entry", "path", header.Name, "error", err)
+			continue
 		}
 
+		ta.logger().Info("Extracting", "path", header.Name)
+
 		// Handle different file types
 		switch header.Typeflag {
 		case tar.TypeDir:
-			// Create directory
-			if err := os.MkdirAll(targetPath, header.FileInfo().Mode()); err != nil {
+			// Replace anything but a directory, so as not to follow a link
+			if info, err := os.Lstat(targetPath); err == nil && !info.IsDir() {
+				if err := os.Remove(targetPath); err != nil {
+					return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+				}
+			}
+			// Create directory, writable by the owner until it is filled
+			if err := os.MkdirAll(targetPath, header.FileInfo().Mode().Perm()|0700); err != nil {
 				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
 			}
+			dirs = append(dirs, header)
 
 		case tar.TypeReg:
 			// Create regular file
@@ -267,35 +370,171 @@ func (ta *TarArchive) Extract(destDir string) error {
 				return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
 			}
 
-			outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_RDWR, header.FileInfo().Mode())
+			// Replace what is there rather than writing into it, or through
+			// it if it is a link
+			if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+			}
+			outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC|openNoFollow, header.FileInfo().Mode())
 			if err != nil {
 				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
 			}
 
-			_, err = io.Copy(outFile, tarReader)
+			if ta.Options.Sparse {
+				sparse := utils.NewSparseWriter(outFile)
+				_, err = io.Copy(sparse, tarReader)
+				if err == nil {
+					err = sparse.Close()
+				}
+			} else {
+				_, err = io.Copy(outFile, tarReader)
+			}
 			outFile.Close()
 			if err != nil {
 				return fmt.Errorf("failed to extract file %s: %w", targetPath, err)
 			}
 
+			ta.restoreMetadata(targetPath, header)
+
 			// Preserve timestamps
 			if err := os.Chtimes(targetPath, header.AccessTime, header.ModTime); err != nil {
-				fmt.Printf("Warning: failed to set timestamps for %s: %v\n", targetPath, err)
+				ta.logger().Warn("Failed to set timestamps", "path", targetPath, "error", err)
+			}
+
+		case tar.TypeSymlink:
+			if !ta.Options.Links {
+				ta.logger().Warn("Skipping symlink, links are not enabled", "path", header.Name, "target", header.Linkname)
+				continue
+			}
+			if ta.Options.SafeLinks && utils.IsUnsafeLink(header.Name, header.Linkname) {
+				ta.logger().Warn("Skipping unsafe symlink", "path", header.Name, "target", header.Linkname)
+				continue
+			}
+
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
+			}
+
+			// Replace whatever is at the target path with the link
+			if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", targetPath, err)
+			}
+			ta.restoreMetadata(targetPath, header)
+
+		case tar.TypeLink:
+			// Hard link targets name an earlier entry of the archive
+			linkTarget, err := linkTargetPath(root, header.Linkname)
+			if err != nil {
+				ta.logger().Warn("Skipping unsafe hard link", "path", header.Name, "target", header.Linkname, "error", err)
+				continue
+			}
+
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
+			}
+
+			if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+			}
+			if err := os.Link(linkTarget, targetPath); err != nil {
+				return fmt.Errorf("failed to create hard link %s: %w", targetPath, err)
 			}
 
 		default:
-			fmt.Printf("Warning: unsupported file type %c for %s\n", header.Typeflag, header.Name)
+			ta.logger().Warn("Skipping unsupported file type", "path", header.Name, "type", string(header.Typeflag))
+		}
+	}
+
+	// Deepest directories first, so setting a child's times does not
+	// disturb its parent's
+	for i := len(dirs) - 1; i >= 0; i-- {
+		header := dirs[i]
+		targetPath := filepath.Join(root, filepath.FromSlash(header.Name))
+
+		// A later entry may have replaced the directory
+		if info, err := os.Lstat(targetPath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		ta.restoreMetadata(targetPath, header)
+
+		if err := os.Chtimes(targetPath, header.AccessTime, header.ModTime); err != nil {
+			ta.logger().Warn("Failed to set timestamps", "path", targetPath, "error", err)
 		}
 	}
 
 	return nil
 }
 
+// entryPath returns the path under root, a directory without symlinks in
+// its path, of the archive entry name. It fails if the entry would land
+// outside root, either through ".." or through a symlink extracted earlier
+// in the directories leading to it.
+func entryPath(root, name string) (string, error) {
+	relPath := filepath.FromSlash(name)
+	if !filepath.IsLocal(relPath) {
+		return "", fmt.Errorf("path is outside the destination")
+	}
+
+	parent, err := resolveExisting(filepath.Join(root, filepath.Dir(relPath)))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, parent); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("parent directory leads outside the destination through a symlink")
+	}
+	return filepath.Join(root, relPath), nil
+}
+
+// linkTargetPath returns the path under root of the target of a hard link
+// entry. Unlike other entries, the target may not be reached through any
+// symlink, nor be one, as some systems would link to what it points to.
+func linkTargetPath(root, name string) (string, error) {
+	path, err := entryPath(root, name)
+	if err != nil {
+		return "", err
+	}
+	if parent, err := filepath.EvalSymlinks(filepath.Dir(path)); err != nil || parent != filepath.Dir(path) {
+		return "", fmt.Errorf("target is reached through a symlink")
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("target is a symlink")
+	}
+	return path, nil
+}
+
+// resolveExisting resolves the symlinks in path as far as it exists. The
+// part that does not exist yet is kept as it is, to be created as
+// directories.
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// A dangling link could be created through
+		if _, err := os.Lstat(path); err == nil {
+			return "", fmt.Errorf("%s is a dangling symlink", path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
 // List returns a list of files in the TAR archive
 func (ta *TarArchive) List() ([]TarFileInfo, error) {
-	if ta.Options.Verbose {
-		fmt.Printf("Listing contents of TAR archive: %s\n", ta.Path)
-	}
+	ta.logger().Debug("Listing TAR archive", "archive", ta.Path)
 
 	// Open the archive file
 	file, err := os.Open(ta.Path)
@@ -344,6 +583,9 @@ func (ta *TarArchive) List() ([]TarFileInfo, error) {
 			IsDir:   header.Typeflag == tar.TypeDir,
 			Mode:    header.FileInfo().Mode(),
 		}
+		if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+			fileInfo.LinkTarget = header.Linkname
+		}
 
 		files = append(files, fileInfo)
 	}
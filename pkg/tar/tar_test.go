@@ -1,9 +1,14 @@
 package tar
 
 import (
+	"archive/tar"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/osmontero/msync/internal/utils"
+	"github.com/osmontero/msync/pkg/filter"
 )
 
 func TestTarArchive_Create(t *testing.T) {
@@ -278,7 +283,7 @@ func TestIsTarFile(t *testing.T) {
 
 func TestParseTarOptions(t *testing.T) {
 	tests := []struct {
-		path             string
+		path              string
 		expectCompression bool
 		expectEncryption  bool
 	}{
@@ -301,4 +306,442 @@ func TestParseTarOptions(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestTarArchive_CreateWithFilter(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	for _, name := range []string{"keep.txt", "skip.pyc", "node_modules/lib.js"} {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	rules, err := filter.Parse([]string{"- *.pyc", "- node_modules/"})
+	if err != nil {
+		t.Fatalf("Failed to parse filter rules: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "filtered.tar")
+	archive, err := New(archivePath, TarOptions{Filter: rules})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	files, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+
+	if len(files) != 1 || files[0].Name != "keep.txt" {
+		t.Errorf("Expected only keep.txt in archive, got %v", files)
+	}
+}
+
+func TestTarArchive_CreateWithIgnoreFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	files := map[string]string{
+		"sub/.msyncignore": "*.bak\n",
+		"sub/data.bak":     "backup",
+		"sub/data.txt":     "data",
+		"top.bak":          "not ignored",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	rules := filter.New()
+	rules.AddIgnoreFile(".msyncignore")
+
+	archivePath := filepath.Join(tempDir, "ignored.tar")
+	archive, err := New(archivePath, TarOptions{Filter: rules})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	entries, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, f := range entries {
+		names[f.Name] = true
+	}
+	for _, name := range []string{"sub/.msyncignore", "sub/data.txt", "top.bak"} {
+		if !names[name] {
+			t.Errorf("Expected %s in archive", name)
+		}
+	}
+	if names["sub/data.bak"] {
+		t.Error("Expected sub/data.bak to be ignored")
+	}
+}
+
+func TestTarArchive_Symlinks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "real.txt"), []byte("real"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink("real.txt", filepath.Join(sourceDir, "link.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(sourceDir, "unsafe")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "links.tar")
+	archive, err := New(archivePath, TarOptions{Links: true, SafeLinks: true})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	entries, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name == "unsafe" {
+			t.Error("Unsafe symlink should not be archived")
+		}
+		if entry.Name == "link.txt" && entry.LinkTarget != "real.txt" {
+			t.Errorf("Expected link.txt -> real.txt, got %q", entry.LinkTarget)
+		}
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(extractDir, "link.txt"))
+	if err != nil {
+		t.Fatalf("Expected link.txt to be extracted as a symlink: %v", err)
+	}
+	if target != "real.txt" {
+		t.Errorf("Expected extracted link to point to real.txt, got %s", target)
+	}
+
+	// Without Links the archive stores the content of the link target
+	derefPath := filepath.Join(tempDir, "deref.tar")
+	deref, err := New(derefPath, TarOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := deref.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+	entries, err = deref.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name == "link.txt" && (entry.LinkTarget != "" || entry.Size != 4) {
+			t.Errorf("Expected link.txt to be stored as a 4 byte file, got %+v", entry)
+		}
+	}
+}
+
+// writeEntries writes a TAR archive of headers, each file holding its name
+func writeEntries(t *testing.T, path string, headers []*tar.Header) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write header: %v", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(header.Name)); err != nil {
+				t.Fatalf("Failed to write entry: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+}
+
+func TestTarArchive_ExtractEscape(t *testing.T) {
+	tempDir := t.TempDir()
+	outsideDir := filepath.Join(tempDir, "outside")
+	if err := os.MkdirAll(outsideDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	secretPath := filepath.Join(outsideDir, "secret")
+	if err := os.WriteFile(secretPath, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	// A link to a directory outside, then a hard link and a file through it
+	archivePath := filepath.Join(tempDir, "escape.tar")
+	writeEntries(t, archivePath, []*tar.Header{
+		{Name: "d", Typeflag: tar.TypeSymlink, Linkname: outsideDir, Mode: 0777},
+		{Name: "secret", Typeflag: tar.TypeLink, Linkname: "d/secret"},
+		{Name: "d/file", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+
+	for _, options := range []TarOptions{{}, {Links: true}} {
+		extractDir := filepath.Join(t.TempDir(), "extract")
+		archive, err := New(archivePath, options)
+		if err != nil {
+			t.Fatalf("Failed to create archive: %v", err)
+		}
+		if err := archive.Extract(extractDir); err != nil {
+			t.Fatalf("Failed to extract TAR archive: %v", err)
+		}
+
+		for _, path := range []string{filepath.Join(outsideDir, "file"), filepath.Join(filepath.Dir(extractDir), "escaped")} {
+			if _, err := os.Lstat(path); !os.IsNotExist(err) {
+				t.Errorf("Links %v: expected nothing written at %s, got %v", options.Links, path, err)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(extractDir, "secret")); !os.IsNotExist(err) {
+			t.Errorf("Links %v: expected no hard link through the symlink, got %v", options.Links, err)
+		}
+		info, err := os.Lstat(filepath.Join(extractDir, "d"))
+		if err != nil {
+			t.Fatalf("Failed to stat d: %v", err)
+		}
+		if isLink := info.Mode()&os.ModeSymlink != 0; isLink != options.Links {
+			t.Errorf("Links %v: expected d to be a symlink only with Links, got mode %v", options.Links, info.Mode())
+		}
+	}
+}
+
+func TestTarArchive_ExtractReplacesFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	outsidePath := filepath.Join(tempDir, "outside")
+	if err := os.WriteFile(outsidePath, []byte("outside"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := os.MkdirAll(extractDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	// A link where a file is extracted, and a longer file than the entry
+	if err := os.Symlink(outsidePath, filepath.Join(extractDir, "a")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(extractDir, "b"), []byte("stale content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "files.tar")
+	writeEntries(t, archivePath, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "b", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+	archive, err := New(archivePath, TarOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	if data, err := os.ReadFile(outsidePath); err != nil || string(data) != "outside" {
+		t.Errorf("Expected the link target to be untouched, got %q, %v", data, err)
+	}
+	for _, name := range []string{"a", "b"} {
+		info, err := os.Lstat(filepath.Join(extractDir, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("Expected %s to be a regular file, got %v", name, err)
+			continue
+		}
+		if data, _ := os.ReadFile(filepath.Join(extractDir, name)); string(data) != name {
+			t.Errorf("Expected %s to hold %q, got %q", name, name, data)
+		}
+	}
+}
+
+func TestTarArchive_ExtractPreservesMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	subDir := filepath.Join(sourceDir, "sub")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	scriptPath := filepath.Join(subDir, "run.sh")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chmod(scriptPath, 0750); err != nil {
+		t.Fatalf("Failed to chmod file: %v", err)
+	}
+	if err := os.Chmod(subDir, 0700); err != nil {
+		t.Fatalf("Failed to chmod directory: %v", err)
+	}
+	dirTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(subDir, dirTime, dirTime); err != nil {
+		t.Fatalf("Failed to set directory times: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "perms.tar")
+	archive, err := New(archivePath, TarOptions{Perms: true})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(extractDir, "sub", "run.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat extracted file: %v", err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("Expected file mode 0750, got %o", info.Mode().Perm())
+	}
+
+	info, err = os.Stat(filepath.Join(extractDir, "sub"))
+	if err != nil {
+		t.Fatalf("Failed to stat extracted directory: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Expected directory mode 0700, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(dirTime) {
+		t.Errorf("Expected directory mtime %v, got %v", dirTime, info.ModTime())
+	}
+}
+
+func TestTarArchive_HardLinks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	content := []byte("shared content")
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Link(filepath.Join(sourceDir, "a.txt"), filepath.Join(sourceDir, "b.txt")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "links.tar")
+	archive, err := New(archivePath, TarOptions{HardLinks: true})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	entries, err := archive.List()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name == "b.txt" && (entry.LinkTarget != "a.txt" || entry.Size != 0) {
+			t.Errorf("Expected b.txt to be stored as a link to a.txt, got %+v", entry)
+		}
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	a, err := os.Stat(filepath.Join(extractDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat a.txt: %v", err)
+	}
+	b, err := os.Stat(filepath.Join(extractDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat b.txt: %v", err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("Expected b.txt to be extracted as a hard link to a.txt")
+	}
+
+	data, err := os.ReadFile(filepath.Join(extractDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read b.txt: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Errorf("Expected %q, got %q", content, data)
+	}
+}
+
+func TestTarArchive_Xattrs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	sourceFile := filepath.Join(sourceDir, "file.txt")
+	if err := os.WriteFile(sourceFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := utils.SetXattr(sourceFile, "user.msync.test", []byte("value")); err != nil {
+		t.Skipf("Extended attributes are not supported here: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "xattrs.tar")
+	archive, err := New(archivePath, TarOptions{Xattrs: true})
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Create(sourceDir); err != nil {
+		t.Fatalf("Failed to create TAR archive: %v", err)
+	}
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := archive.Extract(extractDir); err != nil {
+		t.Fatalf("Failed to extract TAR archive: %v", err)
+	}
+
+	attrs, err := utils.Xattrs(filepath.Join(extractDir, "file.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read extracted attributes: %v", err)
+	}
+	if string(attrs["user.msync.test"]) != "value" {
+		t.Errorf("Expected user.msync.test=value, got %q", attrs["user.msync.test"])
+	}
+}
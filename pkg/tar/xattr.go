@@ -0,0 +1,54 @@
+package tar
+
+import (
+	"archive/tar"
+	"fmt"
+	"strings"
+
+	"github.com/osmontero/msync/internal/utils"
+)
+
+// paxXattrPrefix is the PAX record namespace for extended attributes
+const paxXattrPrefix = "SCHILY.xattr."
+
+// addXattrs stores the selected extended attributes of path in the PAX
+// records of its header
+func (ta *TarArchive) addXattrs(header *tar.Header, path string) error {
+	if !ta.Options.Xattrs && !ta.Options.ACLs || header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	attrs, err := utils.Xattrs(path)
+	if err != nil {
+		return fmt.Errorf("failed to read extended attributes for %s: %w", path, err)
+	}
+
+	for name, value := range utils.SelectXattrs(attrs, ta.Options.Xattrs, ta.Options.ACLs) {
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords[paxXattrPrefix+name] = string(value)
+	}
+	return nil
+}
+
+// restoreXattrs sets the selected extended attributes recorded for an
+// archive entry on the extracted path
+func (ta *TarArchive) restoreXattrs(targetPath string, header *tar.Header) {
+	if !ta.Options.Xattrs && !ta.Options.ACLs || header.Typeflag == tar.TypeSymlink {
+		return
+	}
+
+	attrs := make(map[string][]byte)
+	for key, value := range header.PAXRecords {
+		if name, ok := strings.CutPrefix(key, paxXattrPrefix); ok {
+			attrs[name] = []byte(value)
+		}
+	}
+
+	for name, value := range utils.SelectXattrs(attrs, ta.Options.Xattrs, ta.Options.ACLs) {
+		if err := utils.SetXattr(targetPath, name, value); err != nil {
+			ta.logger().Warn("Failed to set extended attribute", "path", targetPath, "name", name, "error", err)
+		}
+	}
+}